@@ -1,8 +1,9 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"time"
 
 	"github.com/22Fariz22/wallet/config"
 	"github.com/22Fariz22/wallet/internal/server"
@@ -35,21 +36,6 @@ func main() {
 		cfg.Postgres.PgDriver,
 	)
 
-	// Формирование строки подключения для GORM
-	dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s",
-		cfg.Postgres.PostgresqlHost,
-		cfg.Postgres.PostgresqlPort,
-		cfg.Postgres.PostgresqlUser,
-		cfg.Postgres.PostgresqlDbname,
-		cfg.Postgres.PostgresqlPassword,
-	)
-
-	// Выполнение миграций
-	if err := migrate.Migrate(appLogger, dsn); err != nil {
-		appLogger.Errorf("Failed to run migrations: %v", err)
-	}
-	appLogger.Debug("Database migrated successfully")
-
 	psqlDB, err := postgres.NewPsqlDB(cfg)
 	if err != nil {
 		appLogger.Fatalf("Postgresql init: %s", err)
@@ -58,11 +44,25 @@ func main() {
 	}
 	defer psqlDB.Close()
 
-	redisClient := redis.NewRedisClient(cfg)
+	// Сервис не стартует на схеме, которая не соответствует коду
+	if err := migrate.Migrate(context.Background(), appLogger, psqlDB); err != nil {
+		appLogger.Fatalf("Failed to run migrations: %v", err)
+	}
+	appLogger.Info("Database migrated successfully")
+
+	redisClient, redisBreaker := redis.NewRedisClient(cfg, appLogger)
 	defer redisClient.Close()
-	appLogger.Info("Redis connected")
 
-	s := server.NewServer(cfg, psqlDB, redisClient, appLogger)
+	// Без Redis сервис работает, балансы читаются напрямую из Postgres
+	pingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := redisClient.Ping(pingCtx).Err(); err != nil {
+		appLogger.Warnf("Redis is unavailable, wallet balances will be served from Postgres: %v", err)
+	} else {
+		appLogger.Info("Redis connected")
+	}
+	cancel()
+
+	s := server.NewServer(cfg, psqlDB, redisClient, redisBreaker, appLogger)
 	if err = s.Run(); err != nil {
 		appLogger.Fatalf("Error in main NewServer(): ", err)
 	}
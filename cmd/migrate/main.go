@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/pkg/db/migrate"
+	"github.com/22Fariz22/wallet/pkg/db/postgres"
+	"github.com/22Fariz22/wallet/pkg/logger"
+)
+
+const usage = `Usage: migrate <command> [args]
+
+Commands:
+  up             apply all pending migrations
+  down [N]       roll back the last N applied migrations (default 1)
+  status         print the current version and pending migrations
+  force VERSION  mark migrations up to VERSION as applied without running them,
+                 use after fixing the schema by hand; 0 marks all as not applied
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Аргументы проверяются до подключения к базе
+	cmd, arg := flag.Arg(0), int64(0)
+	switch cmd {
+	case "up", "status":
+	case "down":
+		arg = 1
+		if flag.NArg() > 1 {
+			steps, err := strconv.Atoi(flag.Arg(1))
+			if err != nil || steps <= 0 {
+				log.Fatalf("down: N must be a positive integer, got %q", flag.Arg(1))
+			}
+			arg = int64(steps)
+		}
+	case "force":
+		if flag.NArg() != 2 {
+			log.Fatal("force: VERSION is required")
+		}
+		version, err := strconv.ParseInt(flag.Arg(1), 10, 64)
+		if err != nil || version < 0 {
+			log.Fatalf("force: VERSION must be a non-negative integer, got %q", flag.Arg(1))
+		}
+		arg = version
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+
+	psqlDB, err := postgres.NewPsqlDB(cfg)
+	if err != nil {
+		appLogger.Fatalf("Postgresql init: %s", err)
+	}
+	defer psqlDB.Close()
+
+	m, err := migrate.NewMigrator(psqlDB, appLogger)
+	if err != nil {
+		appLogger.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	switch cmd {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			appLogger.Fatalf("Migration failed: %v", err)
+		}
+		appLogger.Infof("Applied %d migrations", applied)
+
+	case "down":
+		reverted, err := m.Down(ctx, int(arg))
+		if err != nil {
+			appLogger.Fatalf("Rollback failed: %v", err)
+		}
+		appLogger.Infof("Reverted %d migrations", reverted)
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			appLogger.Fatalf("Failed to read migration status: %v", err)
+		}
+		printStatus(statuses)
+
+	case "force":
+		if err := m.Force(ctx, arg); err != nil {
+			appLogger.Fatalf("Failed to force version: %v", err)
+		}
+	}
+}
+
+// printStatus выводит текущую версию схемы и таблицу миграций
+func printStatus(statuses []migrate.MigrationStatus) {
+	var current int64
+	pending := 0
+	for _, st := range statuses {
+		if st.AppliedAt != nil && st.Version > current {
+			current = st.Version
+		}
+		if st.AppliedAt == nil {
+			pending++
+		}
+	}
+	fmt.Printf("Current version: %d, pending: %d\n\n", current, pending)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, st := range statuses {
+		applied := "pending"
+		if st.AppliedAt != nil {
+			applied = st.AppliedAt.Format(time.RFC3339)
+		}
+		if st.Unknown {
+			applied += " (not in this binary)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, applied)
+	}
+	w.Flush()
+}
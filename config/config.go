@@ -17,11 +17,14 @@ type Config struct {
 	Postgres   PostgresConfig
 	Logger     Logger
 	Redis      RedisConfig
+	Wallet     WalletConfig
 }
 
 // API config struct
 type APIConfig struct {
 	APIVersion string
+	// AdminToken Bearer-токен для /admin. Если пуст, административные маршруты не регистрируются
+	AdminToken string
 }
 
 // Server config struct
@@ -77,6 +80,49 @@ type RedisConfig struct {
 	PoolSize             int
 	PoolTimeout          time.Duration
 	WalletAmountCasheTTL time.Duration
+	// Случайная добавка к TTL, чтобы ключи, записанные одновременно, не истекали разом
+	WalletCacheTTLJitter time.Duration
+	// Префикс ключей кэша, чтобы несколько окружений могли делить один Redis
+	WalletCacheKeyPrefix string
+	WalletCacheEnabled   bool
+	// Короткая блокировка в Redis на время заполнения остывшего ключа,
+	// чтобы из БД его перечитывала только одна реплика
+	WalletCacheLockEnabled bool
+	WalletCacheLockTTL     time.Duration
+	// Сколько остальные реплики ждут заполнения ключа, прежде чем пойти в БД сами
+	WalletCacheLockWait time.Duration
+	// Сколько ошибок подряд размыкают circuit breaker и через сколько пробовать Redis снова
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+}
+
+// Wallet config struct
+type WalletConfig struct {
+	DefaultCurrency string
+	// Лимиты по умолчанию для кошельков без собственных лимитов, в минимальных
+	// единицах валюты. 0 означает отсутствие ограничения
+	MaxOperationAmount     int64
+	MaxBalance             int64
+	DailyWithdrawalLimit   int64
+	MonthlyWithdrawalLimit int64
+	// HoldTTL через сколько неиспользованный холд снимается автоматически
+	HoldTTL time.Duration
+	// HoldSweepInterval как часто снимаются истекшие холды, 0 отключает фоновую очистку
+	HoldSweepInterval time.Duration
+	// SchedulePollInterval как часто воркер ищет наступившие запланированные операции,
+	// 0 отключает выполнение расписаний на этой реплике
+	SchedulePollInterval time.Duration
+	// ScheduleBatchSize сколько запусков одна реплика берет в работу за один проход
+	ScheduleBatchSize int
+	// FundingAccount системный счет главной книги, который дебетуется при пополнениях,
+	// PayoutAccount кредитуется при списаниях. После переименования старые проводки
+	// остаются на прежних счетах
+	FundingAccount string
+	PayoutAccount  string
+	// IdempotencyInProgressTimeout через сколько незавершенный резерв ключа идемпотентности
+	// считается брошенным (упал процесс, не сохранился ответ) и повтор может его забрать.
+	// Должен быть больше времени выполнения операции, 0 отключает перехват
+	IdempotencyInProgressTimeout time.Duration
 }
 
 // LoadConfig reads environment variables into a Config struct
@@ -89,6 +135,7 @@ func LoadConfig() (*Config, error) {
 	return &Config{
 		API: APIConfig{
 			APIVersion: getEnv("API_VERSION", "/api/v1"),
+			AdminToken: getEnv("ADMIN_API_TOKEN", ""),
 		},
 		Server: ServerConfig{
 			AppVersion:        getEnv("APP_VERSION", "1.0.0"),
@@ -135,6 +182,35 @@ func LoadConfig() (*Config, error) {
 			PoolSize:             getEnvAsInt("REDIS_POOL_SIZE", 500),
 			PoolTimeout:          getEnvAsDuration("REDIS_POOL_TIMEOUT", 30*time.Second),
 			WalletAmountCasheTTL: getEnvAsDuration("REDIS_WALLET_AMOUNT_CACHE_TTL", 6*time.Hour),
+			WalletCacheTTLJitter: getEnvAsDuration("REDIS_WALLET_CACHE_TTL_JITTER", time.Minute),
+			WalletCacheKeyPrefix: getEnv("REDIS_WALLET_CACHE_KEY_PREFIX", ""),
+			WalletCacheEnabled:   getEnvAsBool("REDIS_WALLET_CACHE_ENABLED", true),
+
+			WalletCacheLockEnabled: getEnvAsBool("REDIS_WALLET_CACHE_LOCK_ENABLED", false),
+			WalletCacheLockTTL:     getEnvAsDuration("REDIS_WALLET_CACHE_LOCK_TTL", 3*time.Second),
+			WalletCacheLockWait:    getEnvAsDuration("REDIS_WALLET_CACHE_LOCK_WAIT", 500*time.Millisecond),
+
+			BreakerFailureThreshold: getEnvAsInt("REDIS_BREAKER_FAILURE_THRESHOLD", 5),
+			BreakerOpenTimeout:      getEnvAsDuration("REDIS_BREAKER_OPEN_TIMEOUT", 10*time.Second),
+		},
+		Wallet: WalletConfig{
+			DefaultCurrency: getEnv("WALLET_DEFAULT_CURRENCY", "RUB"),
+
+			MaxOperationAmount:     getEnvAsInt64("WALLET_MAX_OPERATION_AMOUNT", 0),
+			MaxBalance:             getEnvAsInt64("WALLET_MAX_BALANCE", 0),
+			DailyWithdrawalLimit:   getEnvAsInt64("WALLET_DAILY_WITHDRAWAL_LIMIT", 0),
+			MonthlyWithdrawalLimit: getEnvAsInt64("WALLET_MONTHLY_WITHDRAWAL_LIMIT", 0),
+
+			HoldTTL:           getEnvAsDuration("WALLET_HOLD_TTL", 7*24*time.Hour),
+			HoldSweepInterval: getEnvAsDuration("WALLET_HOLD_SWEEP_INTERVAL", time.Minute),
+
+			SchedulePollInterval: getEnvAsDuration("WALLET_SCHEDULE_POLL_INTERVAL", 10*time.Second),
+			ScheduleBatchSize:    getEnvAsInt("WALLET_SCHEDULE_BATCH_SIZE", 100),
+
+			FundingAccount: getEnv("WALLET_FUNDING_ACCOUNT", "funding"),
+			PayoutAccount:  getEnv("WALLET_PAYOUT_ACCOUNT", "payout"),
+
+			IdempotencyInProgressTimeout: getEnvAsDuration("WALLET_IDEMPOTENCY_IN_PROGRESS_TIMEOUT", time.Minute),
 		},
 	}, nil
 }
@@ -170,3 +246,11 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsInt64(key string, defaultValue int64) int64 {
+	valStr := getEnv(key, "")
+	if val, err := strconv.ParseInt(valStr, 10, 64); err == nil {
+		return val
+	}
+	return defaultValue
+}
@@ -1,9 +1,436 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Wallet struct {
-	WalletID uuid.UUID `json:"wallet_id" gorm:"type:uuid;primaryKey" db:"wallet_id"`
-	Amount   int64     `json:"amount" gorm:"not null" db:"amount"`
+	WalletID uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	Amount   int64     `json:"amount" db:"amount"`
+	// Currency код ISO 4217, Amount хранится в минимальных единицах этой валюты
+	Currency string `json:"currency" db:"currency"`
+	// Held сумма активных холдов: входит в Amount, но недоступна для списаний и переводов
+	Held int64 `json:"held" db:"held"`
+	// Version увеличивается при каждом изменении баланса или статуса
+	Version int64 `json:"version" db:"version"`
+	// Status состояние кошелька, операции по счету возможны только в active
+	Status string `json:"status" db:"status"`
+	// OwnerID идентификатор клиента во внешней системе, по нему ищутся кошельки клиента
+	OwnerID   string    `json:"owner_id,omitempty" db:"owner_id"`
+	Label     string    `json:"label,omitempty" db:"label"`
+	Metadata  Metadata  `json:"metadata,omitempty" db:"metadata"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// UpdatedAt время последнего изменения баланса, холдов или статуса
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// WalletParams параметры создания кошелька, пришедшие от клиента
+type WalletParams struct {
+	// WalletID задается клиентом, чтобы повтор запроса не создал второй кошелек.
+	// uuid.Nil означает, что ID сгенерирует сервер
+	WalletID uuid.UUID
+	OwnerID  string
+	Label    string
+	Currency string
+	Metadata Metadata
+}
+
+// Available доступный баланс: проведенный за вычетом зарезервированного холдами
+func (w *Wallet) Available() int64 {
+	return w.Amount - w.Held
+}
+
+// SameAttributes сравнивает атрибуты, заданные при создании кошелька.
+// Баланс, статус и версия меняются со временем и не сравниваются
+func (w *Wallet) SameAttributes(other *Wallet) bool {
+	return w.Currency == other.Currency &&
+		w.OwnerID == other.OwnerID &&
+		w.Label == other.Label &&
+		w.Metadata.Equal(other.Metadata)
+}
+
+// Metadata произвольный JSON-объект клиента, хранится в jsonb как есть
+type Metadata json.RawMessage
+
+// Equal сравнивает метаданные по содержимому: jsonb не сохраняет
+// порядок ключей и пробелы, поэтому побайтовое сравнение не подходит
+func (m Metadata) Equal(other Metadata) bool {
+	var a, b interface{}
+	if err := json.Unmarshal(m.orEmpty(), &a); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(other.orEmpty(), &b); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// orEmpty пустые метаданные равнозначны пустому объекту
+func (m Metadata) orEmpty() []byte {
+	if len(m) == 0 {
+		return []byte("{}")
+	}
+	return m
+}
+
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	return m.orEmpty(), nil
+}
+
+// UnmarshalJSON null означает отсутствие метаданных, как и пропущенное поле
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	*m = append((*m)[0:0], data...)
+	return nil
+}
+
+// Value пустые метаданные пишутся как пустой объект
+func (m Metadata) Value() (driver.Value, error) {
+	return string(m.orEmpty()), nil
+}
+
+// Scan копирует байты: буфер драйвера переиспользуется при чтении следующей строки
+func (m *Metadata) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+	case []byte:
+		*m = append(Metadata(nil), v...)
+	case string:
+		*m = Metadata(v)
+	default:
+		return fmt.Errorf("unsupported metadata type %T", src)
+	}
+	return nil
 }
 
+// Статусы кошелька
+const (
+	WalletStatusActive = "active"
+	WalletStatusFrozen = "frozen"
+	WalletStatusClosed = "closed"
+)
+
+// walletStatusTransitions допустимые переходы между статусами. closed конечный
+var walletStatusTransitions = map[string][]string{
+	WalletStatusActive: {WalletStatusFrozen, WalletStatusClosed},
+	WalletStatusFrozen: {WalletStatusActive, WalletStatusClosed},
+}
+
+// CanTransitionTo проверяет, можно ли перевести кошелек в статус status
+func (w *Wallet) CanTransitionTo(status string) bool {
+	for _, next := range walletStatusTransitions[w.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// WalletLimits лимиты кошелька в минимальных единицах валюты. Незаданный (nil)
+// лимит берется из настроек по умолчанию, нулевой означает отсутствие ограничения
+type WalletLimits struct {
+	WalletID           uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	MaxOperationAmount *int64    `json:"max_operation_amount" db:"max_operation_amount"`
+	MaxBalance         *int64    `json:"max_balance" db:"max_balance"`
+	// Суммарные списания и исходящие переводы за последние сутки и 30 дней
+	DailyWithdrawalLimit   *int64 `json:"daily_withdrawal_limit" db:"daily_withdrawal_limit"`
+	MonthlyWithdrawalLimit *int64 `json:"monthly_withdrawal_limit" db:"monthly_withdrawal_limit"`
+}
+
+// WithDefaults подставляет вместо незаданных лимитов значения из defaults
+func (l WalletLimits) WithDefaults(defaults WalletLimits) WalletLimits {
+	if l.MaxOperationAmount == nil {
+		l.MaxOperationAmount = defaults.MaxOperationAmount
+	}
+	if l.MaxBalance == nil {
+		l.MaxBalance = defaults.MaxBalance
+	}
+	if l.DailyWithdrawalLimit == nil {
+		l.DailyWithdrawalLimit = defaults.DailyWithdrawalLimit
+	}
+	if l.MonthlyWithdrawalLimit == nil {
+		l.MonthlyWithdrawalLimit = defaults.MonthlyWithdrawalLimit
+	}
+	return l
+}
+
+// Типы операций в журнале транзакций
+const (
+	TransactionTypeDeposit     = "DEPOSIT"
+	TransactionTypeWithdraw    = "WITHDRAW"
+	TransactionTypeTransferIn  = "TRANSFER_IN"
+	TransactionTypeTransferOut = "TRANSFER_OUT"
+	// TransactionTypeCapture списание зарезервированных холдом средств
+	TransactionTypeCapture = "CAPTURE"
+	// TransactionTypeReversal сторно: компенсирующая запись, ссылается на исходную через ReversalOf
+	TransactionTypeReversal = "REVERSAL"
+)
+
+// OperationTypeTransfer тип операции перевода в API, в журнале пишется двумя записями
+const OperationTypeTransfer = "TRANSFER"
+
+// OperationTypeReverse сторно операции в API, в журнале пишется записью REVERSAL
+const OperationTypeReverse = "REVERSE"
+
+// Операции с холдами в API. В журнал попадает только CAPTURE: HOLD и RELEASE
+// не меняют проведенный баланс
+const (
+	OperationTypeHold    = "HOLD"
+	OperationTypeCapture = "CAPTURE"
+	OperationTypeRelease = "RELEASE"
+)
+
+// Статусы холда
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold резерв средств кошелька под будущее списание (авторизация).
+// Пока холд активен, его сумма учтена в Wallet.Held
+type Hold struct {
+	ID       uuid.UUID `json:"id" db:"id"`
+	WalletID uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	// Amount еще не списанная часть резерва, уменьшается при частичных списаниях
+	Amount    int64     `json:"amount" db:"amount"`
+	Captured  int64     `json:"captured" db:"captured"`
+	Status    string    `json:"status" db:"status"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Периодичность расписания. Пустая периодичность означает разовую операцию
+const (
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+// Статусы расписания
+const (
+	ScheduleStatusActive    = "active"
+	ScheduleStatusCompleted = "completed"
+	ScheduleStatusCancelled = "cancelled"
+)
+
+// Schedule запланированная операция DEPOSIT, WITHDRAW или TRANSFER: разовая
+// в момент StartAt либо повторяющаяся начиная с него
+type Schedule struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	WalletID      uuid.UUID  `json:"wallet_id" db:"wallet_id"`
+	OperationType string     `json:"operation_type" db:"operation_type"`
+	ToWalletID    *uuid.UUID `json:"to_wallet_id,omitempty" db:"to_wallet_id"`
+	Amount        int64      `json:"amount" db:"amount"`
+	Recurrence    string     `json:"recurrence,omitempty" db:"recurrence"`
+	StartAt       time.Time  `json:"start_at" db:"start_at"`
+	NextRunAt     time.Time  `json:"next_run_at" db:"next_run_at"`
+	// Iteration номер следующего запуска от StartAt, пропущенные запуски тоже считаются.
+	// Даты считаются от StartAt, а не от предыдущего запуска, чтобы 31-е число не сползало
+	Iteration int       `json:"-" db:"iteration"`
+	Status    string    `json:"status" db:"status"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// ValidRecurrence проверяет периодичность, пустая означает разовую операцию
+func ValidRecurrence(recurrence string) bool {
+	switch recurrence {
+	case "", RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly:
+		return true
+	}
+	return false
+}
+
+// Advance переводит расписание на первый запуск позже now. Разовое расписание
+// и расписание с неизвестной периодичностью завершаются
+func (s *Schedule) Advance(now time.Time) {
+	if s.Recurrence == "" || !ValidRecurrence(s.Recurrence) {
+		s.Status = ScheduleStatusCompleted
+		return
+	}
+	// Запуски, пропущенные пока воркеры не работали, не догоняются
+	for !s.NextRunAt.After(now) {
+		s.Iteration++
+		s.NextRunAt = s.occurrence(s.Iteration)
+	}
+}
+
+// occurrence время n-го запуска, нулевой запуск приходится на StartAt
+func (s *Schedule) occurrence(n int) time.Time {
+	switch s.Recurrence {
+	case RecurrenceDaily:
+		return s.StartAt.AddDate(0, 0, n)
+	case RecurrenceWeekly:
+		return s.StartAt.AddDate(0, 0, 7*n)
+	default:
+		// В коротком месяце операция с 31-го числа выполняется в последний день месяца
+		y, m, d := s.StartAt.Date()
+		first := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, s.StartAt.Location())
+		if last := first.AddDate(0, 1, -1).Day(); d > last {
+			d = last
+		}
+		hh, mm, ss := s.StartAt.Clock()
+		return time.Date(first.Year(), first.Month(), d, hh, mm, ss, s.StartAt.Nanosecond(), s.StartAt.Location())
+	}
+}
+
+// Статусы запуска расписания
+const (
+	ExecutionStatusPending   = "pending"
+	ExecutionStatusSucceeded = "succeeded"
+	ExecutionStatusFailed    = "failed"
+)
+
+// ScheduleExecution запись журнала запусков расписания. Запуск, оставшийся в pending,
+// взят в работу, но реплика остановилась до записи результата: операцию нужно сверить по журналу кошелька
+type ScheduleExecution struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	ScheduleID uuid.UUID `json:"schedule_id" db:"schedule_id"`
+	// RunAt плановое время запуска
+	RunAt         time.Time  `json:"run_at" db:"run_at"`
+	Status        string     `json:"status" db:"status"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty" db:"transaction_id"`
+	Error         string     `json:"error,omitempty" db:"error"`
+	StartedAt     time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// ScheduledRun запуск, взятый воркером в работу: расписание до перевода на следующий запуск
+type ScheduledRun struct {
+	Schedule  Schedule
+	Execution ScheduleExecution
+}
+
+// Transaction запись журнала операций по кошельку (append-only)
+type Transaction struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	WalletID     uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	Type         string    `json:"type" db:"type"`
+	Amount       int64     `json:"amount" db:"amount"`
+	BalanceAfter int64     `json:"balance_after" db:"balance_after"`
+	// CounterpartyID второй кошелек перевода, для пополнений и списаний пуст
+	CounterpartyID *uuid.UUID `json:"counterparty_id,omitempty" db:"counterparty_id"`
+	// ReversalOf исходная операция, которую сторнирует эта запись
+	ReversalOf *uuid.UUID `json:"reversal_of,omitempty" db:"reversal_of"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// reversalDirections операции, которые можно сторнировать: true означает,
+// что сторно возвращает средства на кошелек, false что списывает их
+var reversalDirections = map[string]bool{
+	TransactionTypeDeposit:  false,
+	TransactionTypeWithdraw: true,
+	TransactionTypeCapture:  true,
+}
+
+// ReversalCredits сообщает, пополняет ли кошелек сторно этой операции.
+// ok равен false, если операцию сторнировать нельзя
+func (t *Transaction) ReversalCredits() (credit, ok bool) {
+	credit, ok = reversalDirections[t.Type]
+	return credit, ok
+}
+
+// LedgerEntryOpening проводка главной книги с балансом кошелька, накопленным до ее появления.
+// Остальные проводки имеют тип операции: DEPOSIT, WITHDRAW, TRANSFER, CAPTURE, REVERSAL
+const LedgerEntryOpening = "OPENING"
+
+// SystemAccountOpening системный счет, с которого проведены начальные балансы кошельков
+const SystemAccountOpening = "opening"
+
+// Posting нога проводки главной книги: изменение одного счета. Счет либо кошелек,
+// либо системный счет вроде funding или payout. Amount со знаком: отрицательная
+// нога дебетует счет, положительная кредитует, сумма ног проводки равна нулю
+type Posting struct {
+	WalletID      *uuid.UUID
+	SystemAccount *string
+	Amount        int64
+}
+
+// LedgerCheck результат сверки главной книги целиком
+type LedgerCheck struct {
+	// Balanced все инварианты выполняются
+	Balanced bool `json:"balanced"`
+	// UnbalancedEntries проводки, ноги которых не сходятся в ноль
+	UnbalancedEntries []uuid.UUID `json:"unbalanced_entries"`
+	// MismatchedWallets кошельки, баланс которых не равен сумме их ног
+	MismatchedWallets []uuid.UUID `json:"mismatched_wallets"`
+	// SystemAccounts сальдо системных счетов: сколько денег вошло в систему и вышло из нее
+	SystemAccounts map[string]int64 `json:"system_accounts"`
+	// Total сумма всех ног книги, в сбалансированной книге равна нулю
+	Total int64 `json:"total"`
+}
+
+// TransactionCursor позиция в журнале для постраничной выборки (keyset-пагинация)
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode сериализует курсор в непрозрачную строку для клиента
+func (c TransactionCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseTransactionCursor разбирает курсор, полученный от клиента
+func ParseTransactionCursor(s string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed cursor")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &TransactionCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// TransactionFilter параметры выборки журнала операций кошелька
+type TransactionFilter struct {
+	Type      string
+	From      *time.Time
+	To        *time.Time
+	After     *TransactionCursor
+	Limit     int
+	Ascending bool
+}
+
+// TransactionPage страница журнала операций, NextCursor пуст на последней странице
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
+
+// IdempotencyKey сохраненный результат операции под ключом идемпотентности.
+// StatusCode равен нулю, пока операция под этим ключом еще выполняется.
+type IdempotencyKey struct {
+	Key         string    `json:"key" db:"key"`
+	RequestHash string    `json:"request_hash" db:"request_hash"`
+	StatusCode  int       `json:"status_code" db:"status_code"`
+	Response    []byte    `json:"response" db:"response"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleAdvance(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		recurrence string
+		now        time.Time
+		next       time.Time
+		status     string
+	}{
+		{name: "Once", recurrence: "", now: start, next: start, status: ScheduleStatusCompleted},
+		{name: "Daily", recurrence: RecurrenceDaily, now: start, next: start.AddDate(0, 0, 1), status: ScheduleStatusActive},
+		{name: "Weekly", recurrence: RecurrenceWeekly, now: start, next: start.AddDate(0, 0, 7), status: ScheduleStatusActive},
+		// В високосном феврале 29 дней: 31-е число переносится на последний день месяца
+		{name: "Monthly Short Month", recurrence: RecurrenceMonthly, now: start, next: time.Date(2024, time.February, 29, 9, 0, 0, 0, time.UTC), status: ScheduleStatusActive},
+		// После короткого месяца расписание возвращается к 31-му числу
+		{name: "Monthly After Short Month", recurrence: RecurrenceMonthly, now: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), next: time.Date(2024, time.March, 31, 9, 0, 0, 0, time.UTC), status: ScheduleStatusActive},
+		// Пропущенные запуски не догоняются
+		{name: "Daily Missed Runs", recurrence: RecurrenceDaily, now: start.AddDate(0, 0, 10).Add(time.Hour), next: start.AddDate(0, 0, 11), status: ScheduleStatusActive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Schedule{Recurrence: tt.recurrence, StartAt: start, NextRunAt: start, Status: ScheduleStatusActive}
+
+			s.Advance(tt.now)
+
+			assert.Equal(t, tt.next, s.NextRunAt)
+			assert.Equal(t, tt.status, s.Status)
+		})
+	}
+}
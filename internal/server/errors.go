@@ -0,0 +1,162 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/22Fariz22/wallet/internal/wallet"
+	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorResponse единый формат тела ответа с ошибкой.
+// Code стабилен между версиями API, клиенты ветвятся по нему, а не по тексту.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	// Fields ошибки по отдельным полям запроса, только для VALIDATION_FAILED
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError нарушенное правило валидации одного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type errorMapping struct {
+	err     error
+	status  int
+	code    string
+	message string
+}
+
+// domainErrors сопоставление доменных ошибок с HTTP-статусами и кодами
+var domainErrors = []errorMapping{
+	{wallet.ErrWalletNotFound, http.StatusNotFound, "WALLET_NOT_FOUND", "wallet with the given ID does not exist"},
+	{wallet.ErrInsufficientFunds, http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS", "wallet balance is lower than the requested amount"},
+	{wallet.ErrInvalidAmount, http.StatusBadRequest, "INVALID_AMOUNT", "amount must be a positive integer"},
+	{wallet.ErrSameWallet, http.StatusBadRequest, "SAME_WALLET", "transfer source and destination must be different wallets"},
+	{wallet.ErrUnsupportedCurrency, http.StatusBadRequest, "UNSUPPORTED_CURRENCY", "currency must be a supported ISO 4217 code"},
+	{wallet.ErrCurrencyMismatch, http.StatusUnprocessableEntity, "CURRENCY_MISMATCH", "operation currency does not match the wallet currency"},
+	{wallet.ErrWalletFrozen, http.StatusConflict, "WALLET_FROZEN", "wallet is frozen and does not accept operations"},
+	{wallet.ErrWalletClosed, http.StatusConflict, "WALLET_CLOSED", "wallet is closed and does not accept operations"},
+	{wallet.ErrInvalidStatusTransition, http.StatusConflict, "INVALID_STATUS_TRANSITION", "wallet cannot be moved from its current status to the requested one"},
+	{wallet.ErrWalletNotEmpty, http.StatusConflict, "WALLET_NOT_EMPTY", "only a wallet with zero balance can be closed"},
+	{wallet.ErrInvalidLimit, http.StatusBadRequest, "INVALID_LIMIT", "limits must be non-negative integers, 0 disables the limit"},
+	{wallet.ErrOperationLimitExceeded, http.StatusUnprocessableEntity, "OPERATION_LIMIT_EXCEEDED", "amount is greater than the wallet per-operation limit"},
+	{wallet.ErrBalanceOverflow, http.StatusUnprocessableEntity, "BALANCE_OVERFLOW", "operation would overflow the wallet balance"},
+	{wallet.ErrBalanceLimitExceeded, http.StatusUnprocessableEntity, "BALANCE_LIMIT_EXCEEDED", "operation would raise the balance above the wallet maximum"},
+	{wallet.ErrDailyWithdrawalLimitExceeded, http.StatusUnprocessableEntity, "DAILY_WITHDRAWAL_LIMIT_EXCEEDED", "withdrawals over the last 24 hours would exceed the wallet limit"},
+	{wallet.ErrMonthlyWithdrawalLimitExceeded, http.StatusUnprocessableEntity, "MONTHLY_WITHDRAWAL_LIMIT_EXCEEDED", "withdrawals over the last 30 days would exceed the wallet limit"},
+	{wallet.ErrHoldNotFound, http.StatusNotFound, "HOLD_NOT_FOUND", "hold with the given ID does not exist for this wallet"},
+	{wallet.ErrHoldNotActive, http.StatusConflict, "HOLD_NOT_ACTIVE", "hold was already captured, released or has expired"},
+	{wallet.ErrCaptureExceedsHold, http.StatusUnprocessableEntity, "CAPTURE_EXCEEDS_HOLD", "capture amount is greater than the remaining hold amount"},
+	{wallet.ErrTransactionNotFound, http.StatusNotFound, "TRANSACTION_NOT_FOUND", "transaction with the given ID does not exist for this wallet"},
+	{wallet.ErrNotReversible, http.StatusUnprocessableEntity, "TRANSACTION_NOT_REVERSIBLE", "only DEPOSIT, WITHDRAW and CAPTURE operations can be reversed"},
+	{wallet.ErrAlreadyReversed, http.StatusConflict, "TRANSACTION_ALREADY_REVERSED", "transaction was already reversed for its full amount"},
+	{wallet.ErrReversalExceedsOriginal, http.StatusUnprocessableEntity, "REVERSAL_EXCEEDS_ORIGINAL", "reversal amount is greater than the part of the transaction not yet reversed"},
+	{wallet.ErrInvalidSchedule, http.StatusBadRequest, "INVALID_SCHEDULE", "operationType must be DEPOSIT, WITHDRAW or TRANSFER with a destination wallet, recurrence must be daily, weekly or monthly"},
+	{wallet.ErrScheduleNotFound, http.StatusNotFound, "SCHEDULE_NOT_FOUND", "schedule with the given ID does not exist for this wallet"},
+	{wallet.ErrScheduleNotActive, http.StatusConflict, "SCHEDULE_NOT_ACTIVE", "schedule was already completed or cancelled"},
+	{wallet.ErrScheduleInPast, http.StatusBadRequest, "SCHEDULE_IN_PAST", "runAt must be in the future"},
+	{wallet.ErrWalletExists, http.StatusConflict, "WALLET_ALREADY_EXISTS", "wallet with this ID was already created with different attributes"},
+	{wallet.ErrVersionMismatch, http.StatusPreconditionFailed, "VERSION_MISMATCH", "wallet was modified since the version in If-Match, fetch it again and retry"},
+	{wallet.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "idempotency key was already used with a different request"},
+	{wallet.ErrOperationInProgress, http.StatusConflict, "OPERATION_IN_PROGRESS", "operation with this idempotency key is still in progress, retry later"},
+}
+
+// newHTTPErrorHandler центральный обработчик ошибок Echo: превращает ошибки,
+// возвращенные хендлерами, в ErrorResponse с соответствующим статусом
+func newHTTPErrorHandler(logger logger.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		status, resp := errorResponse(err)
+		if status >= http.StatusInternalServerError {
+			logger.Errorf("Request failed: %s %s, error: %v", c.Request().Method, c.Path(), err)
+		} else {
+			logger.Warnf("Request rejected: %s %s, code: %s, error: %v", c.Request().Method, c.Path(), resp.Code, err)
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(status)
+		} else {
+			err = c.JSON(status, resp)
+		}
+		if err != nil {
+			logger.Errorf("Failed to write error response: %v", err)
+		}
+	}
+}
+
+// errorResponse подбирает HTTP-статус и тело ответа для ошибки
+func errorResponse(err error) (int, ErrorResponse) {
+	for _, m := range domainErrors {
+		if errors.Is(err, m.err) {
+			return m.status, ErrorResponse{Code: m.code, Error: m.err.Error(), Message: m.message}
+		}
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return http.StatusBadRequest, validationErrorResponse(validationErrs)
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		text := strings.ToLower(http.StatusText(he.Code))
+		return he.Code, ErrorResponse{
+			Code:    strings.ToUpper(strings.ReplaceAll(text, " ", "_")),
+			Error:   text,
+			Message: fmt.Sprint(he.Message),
+		}
+	}
+
+	return http.StatusInternalServerError, ErrorResponse{
+		Code:    "INTERNAL_ERROR",
+		Error:   "internal server error",
+		Message: "please try again later",
+	}
+}
+
+// validationErrorResponse ответ на запрос, не прошедший проверку тегов validate
+func validationErrorResponse(errs validator.ValidationErrors) ErrorResponse {
+	resp := ErrorResponse{
+		Code:    "VALIDATION_FAILED",
+		Error:   "validation failed",
+		Message: "request has invalid fields",
+		Fields:  make([]FieldError, 0, len(errs)),
+	}
+	for _, fe := range errs {
+		resp.Fields = append(resp.Fields, FieldError{Field: fe.Field(), Rule: fe.Tag(), Message: fieldErrorMessage(fe)})
+	}
+	return resp
+}
+
+// fieldErrorMessage описание нарушенного правила для клиента
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_unless":
+		return fe.Field() + " is required"
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", fe.Field(), fe.Param())
+	case "gte":
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+	case "len":
+		return fmt.Sprintf("%s must be exactly %s characters long", fe.Field(), fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), fe.Param())
+	default:
+		return fmt.Sprintf("%s failed the %q check", fe.Field(), fe.Tag())
+	}
+}
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
+
 	walletHTTP "github.com/22Fariz22/wallet/internal/wallet/delivery/http"
 	walletRepository "github.com/22Fariz22/wallet/internal/wallet/repository"
 	walletUseCase "github.com/22Fariz22/wallet/internal/wallet/usecase"
@@ -12,10 +15,39 @@ func (s *Server) MapHandlers(e *echo.Echo) error {
 	s.logger.Info("Registering routes...")
 
 	// Init repositories
-	walletRepo := walletRepository.NewWalletRepository(s.db, s.logger, s.redisClient)
+	walletRepo := walletRepository.NewWalletRepository(s.cfg, s.db, s.redisClient, s.logger)
+	if s.redisBreaker != nil && s.cfg.Redis.WalletCacheEnabled {
+		// Пока Redis был недоступен, кэш после записей не сбрасывался: удаляем все снимки.
+		// До конца очистки breaker полуоткрыт, и чтения из кэша считаются промахами
+		s.redisBreaker.OnRecover(func(ctx context.Context) error {
+			return walletRepository.FlushCache(ctx, s.redisClient, s.cfg.Redis, s.logger)
+		})
+	}
 
 	// Init useCases
-	walletUC := walletUseCase.NewWalletUseCase(s.cfg, walletRepo, s.redisClient, s.logger)
+	walletUC := walletUseCase.NewWalletUseCase(s.cfg, walletRepo, s.logger)
+
+	// Истекшие холды снимаются фоновой задачей и возвращают средства в доступный баланс
+	if s.cfg.Wallet.HoldSweepInterval > 0 {
+		s.addWorker(s.periodic("hold-expiry", s.cfg.Wallet.HoldSweepInterval, func(ctx context.Context) error {
+			expired, err := walletUC.ExpireHolds(ctx)
+			if expired > 0 {
+				s.logger.Infof("Expired holds released on %d wallets", expired)
+			}
+			return err
+		}))
+	}
+
+	// Запланированные операции: реплики разбирают наступившие запуски через SKIP LOCKED
+	if s.cfg.Wallet.SchedulePollInterval > 0 {
+		s.addWorker(s.periodic("schedules", s.cfg.Wallet.SchedulePollInterval, func(ctx context.Context) error {
+			executed, err := walletUC.RunDueSchedules(ctx)
+			if executed > 0 {
+				s.logger.Infof("Executed %d scheduled operations", executed)
+			}
+			return err
+		}))
+	}
 
 	// Init handlers
 	walletHandler := walletHTTP.NewWalletHandler(s.cfg, walletUC, s.logger)
@@ -27,6 +59,8 @@ func (s *Server) MapHandlers(e *echo.Echo) error {
 	}))
 	e.Use(middleware.RequestID())
 
+	e.GET("/health", s.Health())
+
 	s.logger.Debug("API Version:", s.cfg.API.APIVersion)
 	v1 := e.Group(s.cfg.API.APIVersion)
 
@@ -34,5 +68,15 @@ func (s *Server) MapHandlers(e *echo.Echo) error {
 
 	walletHTTP.MapWalletRoutes(walletGroup, walletHandler)
 
+	if s.cfg.API.AdminToken == "" {
+		s.logger.Warn("ADMIN_API_TOKEN is not set, admin routes are disabled")
+		return nil
+	}
+
+	adminGroup := v1.Group("/admin", middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		return subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.API.AdminToken)) == 1, nil
+	}))
+	walletHTTP.MapAdminRoutes(adminGroup, walletHandler)
+
 	return nil
 }
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	redisdb "github.com/22Fariz22/wallet/pkg/db/redis"
+	"github.com/labstack/echo/v4"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// HealthResponse состояние сервиса и его зависимостей
+type HealthResponse struct {
+	Status   string `json:"status"`
+	Postgres string `json:"postgres"`
+	Redis    string `json:"redis"`
+}
+
+// Health без Postgres сервис не работает (503), без Redis работает
+// медленнее, но корректно, поэтому только помечается как degraded
+func (s *Server) Health() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), healthCheckTimeout)
+		defer cancel()
+
+		resp := HealthResponse{Status: "ok", Postgres: "up", Redis: "disabled"}
+		status := http.StatusOK
+
+		if err := s.db.PingContext(ctx); err != nil {
+			s.logger.Errorf("Health check: Postgres is unavailable: %v", err)
+			resp.Status, resp.Postgres = "unavailable", "down"
+			status = http.StatusServiceUnavailable
+		}
+
+		if s.redisBreaker != nil {
+			// Состояние circuit breaker: closed, open или half-open
+			state := s.redisBreaker.State()
+			resp.Redis = state.String()
+			if state != redisdb.StateClosed && status == http.StatusOK {
+				resp.Status = "degraded"
+			}
+		}
+
+		return c.JSON(status, resp)
+	}
+}
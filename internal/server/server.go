@@ -6,10 +6,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/22Fariz22/wallet/config"
+	redisdb "github.com/22Fariz22/wallet/pkg/db/redis"
 	"github.com/22Fariz22/wallet/pkg/logger"
 	"github.com/go-playground/validator/v10"
 	"github.com/jmoiron/sqlx"
@@ -19,11 +22,14 @@ import (
 
 // Server struct
 type Server struct {
-	echo        *echo.Echo
-	cfg         *config.Config
-	db          *sqlx.DB
-	redisClient *redis.Client
-	logger      logger.Logger
+	echo         *echo.Echo
+	cfg          *config.Config
+	db           *sqlx.DB
+	redisClient  *redis.Client
+	redisBreaker *redisdb.CircuitBreaker
+	logger       logger.Logger
+	// workers фоновые задачи, регистрируются в MapHandlers
+	workers []worker
 }
 
 // CustomValidator wraps validator
@@ -36,14 +42,29 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 	return cv.Validator.Struct(i)
 }
 
+// newValidator валидатор, который называет поля в ошибках так же, как они называются в JSON запроса
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
 // NewServer New Server constructor
-func NewServer(cfg *config.Config, db *sqlx.DB, redisClient *redis.Client, logger logger.Logger) *Server {
+func NewServer(cfg *config.Config, db *sqlx.DB, redisClient *redis.Client, redisBreaker *redisdb.CircuitBreaker, logger logger.Logger) *Server {
 	e := echo.New()
 
 	// Устанавливаем кастомный валидатор
-	e.Validator = &CustomValidator{Validator: validator.New()}
+	e.Validator = &CustomValidator{Validator: newValidator()}
+	// Единый JSON-формат ошибок для всех хендлеров
+	e.HTTPErrorHandler = newHTTPErrorHandler(logger)
 
-	return &Server{echo: e, cfg: cfg, db: db, redisClient: redisClient, logger: logger}
+	return &Server{echo: e, cfg: cfg, db: db, redisClient: redisClient, redisBreaker: redisBreaker, logger: logger}
 }
 
 func (s *Server) Run() error {
@@ -70,10 +91,15 @@ func (s *Server) Run() error {
 		return err
 	}
 
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	s.startWorkers(workersCtx)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	<-quit
+	stopWorkers()
 
 	ctx, shutdown := context.WithTimeout(context.Background(), s.cfg.Server.CtxTimeout)
 	defer shutdown()
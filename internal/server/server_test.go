@@ -1,11 +1,22 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/wallet"
+	redisdb "github.com/22Fariz22/wallet/pkg/db/redis"
 	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 )
@@ -20,9 +31,165 @@ func TestNewServer(t *testing.T) {
 	redisClient := &redis.Client{}
 	log := logger.NewApiLogger(cfg)
 
-	server := NewServer(cfg, db, redisClient, log)
+	server := NewServer(cfg, db, redisClient, nil, log)
 
 	assert.NotNil(t, server)
 	assert.NotNil(t, server.echo)
 	assert.Equal(t, cfg, server.cfg)
 }
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	handler := newHTTPErrorHandler(logger.NewMockLogger())
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"Wallet not found", wallet.ErrWalletNotFound, http.StatusNotFound, "WALLET_NOT_FOUND"},
+		{"Wrapped insufficient funds", fmt.Errorf("withdraw: %w", wallet.ErrInsufficientFunds), http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS"},
+		{"Invalid amount", wallet.ErrInvalidAmount, http.StatusBadRequest, "INVALID_AMOUNT"},
+		{"Frozen wallet", wallet.ErrWalletFrozen, http.StatusConflict, "WALLET_FROZEN"},
+		{"Closed wallet", wallet.ErrWalletClosed, http.StatusConflict, "WALLET_CLOSED"},
+		{"Close non-empty wallet", wallet.ErrWalletNotEmpty, http.StatusConflict, "WALLET_NOT_EMPTY"},
+		{"Operation limit", wallet.ErrOperationLimitExceeded, http.StatusUnprocessableEntity, "OPERATION_LIMIT_EXCEEDED"},
+		{"Daily withdrawal limit", wallet.ErrDailyWithdrawalLimitExceeded, http.StatusUnprocessableEntity, "DAILY_WITHDRAWAL_LIMIT_EXCEEDED"},
+		{"Hold not found", wallet.ErrHoldNotFound, http.StatusNotFound, "HOLD_NOT_FOUND"},
+		{"Hold not active", wallet.ErrHoldNotActive, http.StatusConflict, "HOLD_NOT_ACTIVE"},
+		{"Transaction not found", wallet.ErrTransactionNotFound, http.StatusNotFound, "TRANSACTION_NOT_FOUND"},
+		{"Already reversed", wallet.ErrAlreadyReversed, http.StatusConflict, "TRANSACTION_ALREADY_REVERSED"},
+		{"Reversal exceeds original", wallet.ErrReversalExceedsOriginal, http.StatusUnprocessableEntity, "REVERSAL_EXCEEDS_ORIGINAL"},
+		{"Schedule not found", wallet.ErrScheduleNotFound, http.StatusNotFound, "SCHEDULE_NOT_FOUND"},
+		{"Schedule not active", wallet.ErrScheduleNotActive, http.StatusConflict, "SCHEDULE_NOT_ACTIVE"},
+		{"Schedule in past", wallet.ErrScheduleInPast, http.StatusBadRequest, "SCHEDULE_IN_PAST"},
+		{"Wallet ID taken", wallet.ErrWalletExists, http.StatusConflict, "WALLET_ALREADY_EXISTS"},
+		{"Version mismatch", wallet.ErrVersionMismatch, http.StatusPreconditionFailed, "VERSION_MISMATCH"},
+		{"Echo HTTP error", echo.ErrNotFound, http.StatusNotFound, "NOT_FOUND"},
+		{"Unknown error", errors.New("db error"), http.StatusInternalServerError, "INTERNAL_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/wallet", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			handler(tt.err, c)
+
+			var resp ErrorResponse
+			assert.Equal(t, tt.status, rec.Code)
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+			assert.NotEmpty(t, resp.Message)
+		})
+	}
+}
+
+func TestHTTPErrorHandler_Validation(t *testing.T) {
+	e := echo.New()
+	handler := newHTTPErrorHandler(logger.NewMockLogger())
+
+	type request struct {
+		Amount   int64  `json:"amount" validate:"gt=0"`
+		Currency string `json:"currency,omitempty" validate:"omitempty,len=3"`
+	}
+	err := (&CustomValidator{Validator: newValidator()}).Validate(&request{Amount: -5, Currency: "RUBL"})
+
+	req := httptest.NewRequest(http.MethodPost, "/wallet", nil)
+	rec := httptest.NewRecorder()
+	handler(err, e.NewContext(req, rec))
+
+	var resp ErrorResponse
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "VALIDATION_FAILED", resp.Code)
+	assert.Equal(t, []FieldError{
+		{Field: "amount", Rule: "gt", Message: "amount must be greater than 0"},
+		{Field: "currency", Rule: "len", Message: "currency must be exactly 3 characters long"},
+	}, resp.Fields)
+}
+
+func TestHealth(t *testing.T) {
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	tests := []struct {
+		name    string
+		pingErr error
+		breaker func() *redisdb.CircuitBreaker
+		status  int
+		body    HealthResponse
+	}{
+		{
+			name:    "Healthy",
+			breaker: func() *redisdb.CircuitBreaker { return redisdb.NewCircuitBreaker(1, time.Minute, log) },
+			status:  http.StatusOK,
+			body:    HealthResponse{Status: "ok", Postgres: "up", Redis: "closed"},
+		},
+		{
+			name: "Redis Down",
+			breaker: func() *redisdb.CircuitBreaker {
+				b := redisdb.NewCircuitBreaker(1, time.Minute, log)
+				// Размыкаем breaker одной сетевой ошибкой
+				hook := b.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error { return errors.New("connection refused") })
+				_ = hook(context.Background(), redis.NewStatusCmd(context.Background(), "ping"))
+				return b
+			},
+			status: http.StatusOK,
+			body:   HealthResponse{Status: "degraded", Postgres: "up", Redis: "open"},
+		},
+		{
+			name:    "Postgres Down",
+			pingErr: errors.New("connection refused"),
+			breaker: func() *redisdb.CircuitBreaker { return nil },
+			status:  http.StatusServiceUnavailable,
+			body:    HealthResponse{Status: "unavailable", Postgres: "down", Redis: "disabled"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sqlMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			defer db.Close()
+			sqlMock.ExpectPing().WillReturnError(tt.pingErr)
+
+			s := NewServer(cfg, sqlx.NewDb(db, "postgres"), nil, tt.breaker(), log)
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			rec := httptest.NewRecorder()
+			c := s.echo.NewContext(req, rec)
+
+			assert.NoError(t, s.Health()(c))
+			assert.Equal(t, tt.status, rec.Code)
+
+			var body HealthResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.body, body)
+			assert.Nil(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPeriodicWorker(t *testing.T) {
+	s := &Server{logger: logger.NewMockLogger()}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := make(chan struct{}, 10)
+	s.addWorker(s.periodic("test", time.Millisecond, func(ctx context.Context) error {
+		calls <- struct{}{}
+		// Ошибка прохода не останавливает задачу
+		return errors.New("sweep failed")
+	}))
+	s.startWorkers(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatal("worker was not run")
+		}
+	}
+	cancel()
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// worker фоновая задача сервера, работает до отмены ctx
+type worker func(ctx context.Context)
+
+// addWorker регистрирует фоновую задачу, она запускается в Run после регистрации маршрутов
+func (s *Server) addWorker(w worker) {
+	s.workers = append(s.workers, w)
+}
+
+// startWorkers запускает зарегистрированные задачи, каждую в своей горутине
+func (s *Server) startWorkers(ctx context.Context) {
+	for _, w := range s.workers {
+		go func(w worker) {
+			defer func() {
+				if r := recover(); r != nil {
+					s.logger.Errorf("Recovered from panic in worker: %v", r)
+				}
+			}()
+			w(ctx)
+		}(w)
+	}
+}
+
+// periodic задача, вызывающая fn раз в interval. Ошибка прохода логируется,
+// следующий проход выполняется по расписанию
+func (s *Server) periodic(name string, interval time.Duration, fn func(ctx context.Context) error) worker {
+	return func(ctx context.Context) {
+		s.logger.Infof("Worker %s started, interval: %s", name, interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				s.logger.Infof("Worker %s stopped", name)
+				return
+			case <-ticker.C:
+				if err := fn(ctx); err != nil && ctx.Err() == nil {
+					s.logger.Errorf("Worker %s failed: %v", name, err)
+				}
+			}
+		}
+	}
+}
@@ -7,5 +7,17 @@ import (
 type Handlers interface {
 	Operation() echo.HandlerFunc
 	Display() echo.HandlerFunc
+	Transactions() echo.HandlerFunc
 	CreateWallet() echo.HandlerFunc
+	List() echo.HandlerFunc
+	Limits() echo.HandlerFunc
+	SetLimits() echo.HandlerFunc
+	CreateSchedule() echo.HandlerFunc
+	Schedules() echo.HandlerFunc
+	CancelSchedule() echo.HandlerFunc
+	ScheduleExecutions() echo.HandlerFunc
+	Freeze() echo.HandlerFunc
+	Unfreeze() echo.HandlerFunc
+	Close() echo.HandlerFunc
+	LedgerCheck() echo.HandlerFunc
 }
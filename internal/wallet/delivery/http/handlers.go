@@ -1,12 +1,24 @@
 package http
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
 	"github.com/22Fariz22/wallet/internal/wallet"
+	"github.com/22Fariz22/wallet/pkg/currency"
 	"github.com/22Fariz22/wallet/pkg/logger"
 	"github.com/22Fariz22/wallet/pkg/utils"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -38,30 +50,183 @@ func (h walletHandlers) Display() echo.HandlerFunc {
 			h.logger.Warnf("Invalid UUID: %s", uuidStr)
 			return c.JSON(http.StatusBadRequest, map[string]string{
 				"error":   "invalid UUID format",
+				"code":    "INVALID_UUID",
 				"message": "UUID must be in valid format (e.g., 550e8400-e29b-41d4-a716-446655440000)",
 			})
 		}
 
-		amount, err := h.walletUsecase.Display(ctx, walletUUID)
+		w, err := h.walletUsecase.Display(ctx, walletUUID)
 		if err != nil {
 			h.logger.Errorf("Failed to fetch balance for wallet %s: %v", walletUUID, err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error":   "internal server error",
-				"message": "please retry query",
-			})
+			return err
 		}
 
+		// Версию из ETag клиент передает в If-Match, чтобы операция не выполнилась
+		// поверх изменений, которых он не видел
+		c.Response().Header().Set(HeaderETag, walletETag(w.Version))
+
+		// amount и formatted оставлены для старых клиентов и равны проведенному балансу
 		return c.JSON(http.StatusOK, map[string]interface{}{
-			"message": "Balance retrieved successfully",
-			"amount":  amount,
+			"message":   "Balance retrieved successfully",
+			"amount":    w.Amount,
+			"posted":    w.Amount,
+			"available": w.Available(),
+			"held":      w.Held,
+			"currency":  w.Currency,
+			"formatted": currency.Format(w.Amount, w.Currency),
+			"status":    w.Status,
+			"version":   w.Version,
 		})
 	}
 }
 
+// Transactions отдает историю операций кошелька постранично.
+// Параметры запроса: type, from, to (RFC3339), cursor, limit, sort (asc|desc)
+func (h walletHandlers) Transactions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("Transactions handler called")
+
+		ctx := c.Request().Context()
+
+		uuidStr := c.Param("uuid")
+		walletUUID, err := utils.ValidateUUID(uuidStr)
+		if err != nil {
+			h.logger.Warnf("Invalid UUID: %s", uuidStr)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid UUID format",
+				"code":    "INVALID_UUID",
+				"message": "UUID must be in valid format (e.g., 550e8400-e29b-41d4-a716-446655440000)",
+			})
+		}
+
+		filter, err := parseTransactionFilter(c)
+		if err != nil {
+			h.logger.Warnf("Invalid transactions filter: %v", err)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid query parameters",
+				"code":    "INVALID_FILTER",
+				"message": err.Error(),
+			})
+		}
+
+		page, err := h.walletUsecase.GetTransactions(ctx, walletUUID, filter)
+		if err != nil {
+			h.logger.Errorf("Failed to fetch transactions for wallet %s: %v", walletUUID, err)
+			return err
+		}
+
+		return c.JSON(http.StatusOK, page)
+	}
+}
+
+// transactionTypes допустимые значения фильтра type
+var transactionTypes = map[string]bool{
+	models.TransactionTypeDeposit:     true,
+	models.TransactionTypeWithdraw:    true,
+	models.TransactionTypeTransferIn:  true,
+	models.TransactionTypeTransferOut: true,
+	models.TransactionTypeCapture:     true,
+	models.TransactionTypeReversal:    true,
+}
+
+// parseTransactionFilter разбирает параметры запроса истории операций
+func parseTransactionFilter(c echo.Context) (models.TransactionFilter, error) {
+	var filter models.TransactionFilter
+
+	if t := c.QueryParam("type"); t != "" {
+		if !transactionTypes[t] {
+			return filter, fmt.Errorf("unknown transaction type %q", t)
+		}
+		filter.Type = t
+	}
+
+	for param, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.QueryParam(param); v != "" {
+			ts, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC3339 timestamp", param)
+			}
+			*dst = &ts
+		}
+	}
+
+	if v := c.QueryParam("cursor"); v != "" {
+		cursor, err := models.ParseTransactionCursor(v)
+		if err != nil {
+			return filter, errors.New("cursor is invalid")
+		}
+		filter.After = cursor
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, errors.New("limit must be a positive integer")
+		}
+		filter.Limit = limit
+	}
+
+	switch c.QueryParam("sort") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, errors.New("sort must be 'asc' or 'desc'")
+	}
+
+	return filter, nil
+}
+
+const (
+	// HeaderIdempotencyKey заголовок с ключом идемпотентности операции
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed выставляется в ответах, отданных из сохраненного результата
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength ограничение длины ключа, совпадает с размером колонки в БД
+	maxIdempotencyKeyLength = 255
+	// HeaderETag версия кошелька в ответе GET /wallets/:uuid
+	HeaderETag = "ETag"
+	// HeaderIfMatch версия кошелька, при которой клиент разрешает выполнить операцию
+	HeaderIfMatch = "If-Match"
+)
+
+// walletETag сильный ETag кошелька по его версии
+func walletETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETag разбирает ETag, выданный walletETag. Слабые ETag (W/"...") не принимаются:
+// для If-Match нужно строгое сравнение
+func parseETag(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return 0, errors.New("malformed ETag")
+	}
+	return strconv.ParseInt(s[1:len(s)-1], 10, 64)
+}
+
+// WalletTransactionRequest тело операции. Теги validate проверяются до разбора UUID
+// и типа операции, поэтому ошибки в них клиент получает сразу списком по полям
 type WalletTransactionRequest struct {
-	WalletID      string `json:"walletId"`
-	OperationType string `json:"operationType"`
-	Amount        int64  `json:"amount"`
+	WalletID      string `json:"walletId" validate:"required"`
+	OperationType string `json:"operationType" validate:"required"`
+	// Amount не нужен только для RELEASE: холд снимается целиком
+	Amount     int64  `json:"amount" validate:"required_unless=OperationType RELEASE,gte=0"`
+	Currency   string `json:"currency,omitempty" validate:"omitempty,len=3"`
+	ToWalletID string `json:"toWalletId,omitempty"`
+	// HoldID холд, по которому выполняется CAPTURE или RELEASE
+	HoldID string `json:"holdId,omitempty"`
+	// TransactionID сторнируемая операция для REVERSE
+	TransactionID string `json:"transactionId,omitempty"`
+	RequestID     string `json:"requestId,omitempty" validate:"max=255"`
+}
+
+// hash отпечаток параметров операции для сравнения повторов под одним ключом
+func (r WalletTransactionRequest) hash() string {
+	r.RequestID = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 func (h walletHandlers) Operation() echo.HandlerFunc {
@@ -76,69 +241,655 @@ func (h walletHandlers) Operation() echo.HandlerFunc {
 			h.logger.Warn("Invalid request body")
 			return c.JSON(http.StatusBadRequest, map[string]string{
 				"error":   "invalid request body",
+				"code":    "INVALID_REQUEST_BODY",
 				"message": "Check JSON structure",
 			})
 		}
 
+		// Ошибки тегов validate превращаются в VALIDATION_FAILED со списком полей центральным обработчиком
+		if err := c.Validate(&req); err != nil {
+			h.logger.Warnf("Invalid operation request: %v", err)
+			return err
+		}
+
 		// Используем функцию из utils
 		walletUUID, err := utils.ValidateUUID(req.WalletID)
 		if err != nil {
 			h.logger.Warnf("Invalid UUID: %s", req.WalletID)
 			return c.JSON(http.StatusBadRequest, map[string]string{
 				"error":   "invalid UUID format",
+				"code":    "INVALID_UUID",
 				"message": "UUID must be in valid format (e.g., 550e8400-e29b-41d4-a716-446655440000)",
 			})
 		}
 
+		// If-Match: операция выполнится, только если версия кошелька walletId не изменилась.
+		// "*" означает любую версию
+		if ifMatch := c.Request().Header.Get(HeaderIfMatch); ifMatch != "" && ifMatch != "*" {
+			version, err := parseETag(ifMatch)
+			if err != nil {
+				h.logger.Warnf("Invalid If-Match: %s", ifMatch)
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":   "invalid If-Match header",
+					"code":    "INVALID_IF_MATCH",
+					"message": "If-Match must be the ETag returned by GET /wallets/:uuid, e.g. \"3\"",
+				})
+			}
+			ctx = wallet.WithExpectedVersion(ctx, version)
+		}
+
+		// resultKey поле ответа с результатом: проводка в журнале или холд
+		resultKey := "transaction"
+		var execute func() (interface{}, error)
 		switch req.OperationType {
-		case "DEPOSIT":
-			err = h.walletUsecase.Deposit(ctx, walletUUID, req.Amount)
-		case "WITHDRAW":
-			err = h.walletUsecase.Withdraw(ctx, walletUUID, req.Amount)
+		case models.TransactionTypeDeposit:
+			execute = func() (interface{}, error) {
+				return h.walletUsecase.Deposit(ctx, walletUUID, req.Amount)
+			}
+		case models.TransactionTypeWithdraw:
+			execute = func() (interface{}, error) {
+				return h.walletUsecase.Withdraw(ctx, walletUUID, req.Amount)
+			}
+		case models.OperationTypeTransfer:
+			toWalletUUID, err := utils.ValidateUUID(req.ToWalletID)
+			if err != nil {
+				h.logger.Warnf("Invalid destination UUID: %s", req.ToWalletID)
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":   "invalid UUID format",
+					"code":    "INVALID_UUID",
+					"message": "toWalletId must be a valid UUID for TRANSFER operations",
+				})
+			}
+			execute = func() (interface{}, error) {
+				return h.walletUsecase.Transfer(ctx, walletUUID, toWalletUUID, req.Amount)
+			}
+		case models.OperationTypeReverse:
+			transactionUUID, err := utils.ValidateUUID(req.TransactionID)
+			if err != nil {
+				h.logger.Warnf("Invalid transaction UUID: %s", req.TransactionID)
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":   "invalid UUID format",
+					"code":    "INVALID_UUID",
+					"message": "transactionId must be a valid UUID for REVERSE operations",
+				})
+			}
+			execute = func() (interface{}, error) {
+				return h.walletUsecase.Reverse(ctx, walletUUID, transactionUUID, req.Amount)
+			}
+		case models.OperationTypeHold:
+			resultKey = "hold"
+			execute = func() (interface{}, error) {
+				return h.walletUsecase.Hold(ctx, walletUUID, req.Amount)
+			}
+		case models.OperationTypeCapture, models.OperationTypeRelease:
+			holdUUID, err := utils.ValidateUUID(req.HoldID)
+			if err != nil {
+				h.logger.Warnf("Invalid hold UUID: %s", req.HoldID)
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":   "invalid UUID format",
+					"code":    "INVALID_UUID",
+					"message": "holdId must be a valid UUID for CAPTURE and RELEASE operations",
+				})
+			}
+			if req.OperationType == models.OperationTypeCapture {
+				execute = func() (interface{}, error) {
+					return h.walletUsecase.Capture(ctx, walletUUID, holdUUID, req.Amount)
+				}
+			} else {
+				resultKey = "hold"
+				execute = func() (interface{}, error) {
+					return h.walletUsecase.Release(ctx, walletUUID, holdUUID)
+				}
+			}
 		default:
 			h.logger.Warnf("Invalid operation type: %s", req.OperationType)
 			return c.JSON(http.StatusBadRequest, map[string]string{
 				"error":   "invalid operation type",
-				"message": "operationType must be 'DEPOSIT' or 'WITHDRAW'",
+				"code":    "INVALID_OPERATION_TYPE",
+				"message": "operationType must be 'DEPOSIT', 'WITHDRAW', 'TRANSFER', 'REVERSE', 'HOLD', 'CAPTURE' or 'RELEASE'",
+			})
+		}
+
+		// Если клиент указал валюту, она должна совпадать с валютой кошелька
+		if req.Currency != "" {
+			if err := h.walletUsecase.CheckCurrency(ctx, walletUUID, req.Currency); err != nil {
+				h.logger.Warnf("Currency check failed: walletID: %s, currency: %s, error: %v", walletUUID, req.Currency, err)
+				return err
+			}
+		}
+
+		// Ключ идемпотентности из заголовка, либо requestId из тела запроса
+		idempotencyKey := c.Request().Header.Get(HeaderIdempotencyKey)
+		if idempotencyKey == "" {
+			idempotencyKey = req.RequestID
+		}
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			h.logger.Warnf("Idempotency key too long: %d", len(idempotencyKey))
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid idempotency key",
+				"code":    "INVALID_IDEMPOTENCY_KEY",
+				"message": "idempotency key must not exceed 255 characters",
 			})
 		}
 
+		if idempotencyKey != "" {
+			record, err := h.walletUsecase.ReserveIdempotencyKey(ctx, idempotencyKey, req.hash())
+			if err != nil {
+				h.logger.Warnf("Idempotency key rejected: key: %s, error: %v", idempotencyKey, err)
+				return err
+			}
+
+			// Повтор завершенного запроса: отдаем сохраненный ответ без повторного выполнения
+			if record != nil {
+				h.logger.Infof("Replaying operation: key: %s, walletID: %s", idempotencyKey, walletUUID)
+				c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+				return c.JSONBlob(record.StatusCode, record.Response)
+			}
+		}
+
+		// Ключ освобождается или завершается и после обрыва соединения клиентом:
+		// иначе он навсегда останется занятым, а повтор получит OPERATION_IN_PROGRESS
+		keyCtx := context.WithoutCancel(ctx)
+
+		result, err := execute()
 		if err != nil {
 			h.logger.Errorf("Operation failed: %s, walletID: %s, amount: %d, error: %v",
 				req.OperationType, walletUUID, req.Amount, err)
 
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error":   "operation failed",
-				"message": "please try again later",
-			})
+			// Освобождаем ключ, чтобы клиент мог повторить неудавшуюся операцию
+			if idempotencyKey != "" {
+				if releaseErr := h.walletUsecase.ReleaseIdempotencyKey(keyCtx, idempotencyKey); releaseErr != nil {
+					h.logger.Errorf("Failed to release idempotency key: %s, error: %v", idempotencyKey, releaseErr)
+				}
+			}
+
+			// Доменные ошибки превращаются в HTTP-ответ центральным обработчиком ошибок
+			return err
 		}
 
 		h.logger.Infof("Operation successful: %s, walletID: %s, amount: %d",
 			req.OperationType, walletUUID, req.Amount)
-		return c.NoContent(http.StatusOK)
+
+		response, err := json.Marshal(map[string]interface{}{
+			"message": "Operation successful",
+			resultKey: result,
+		})
+		if err != nil {
+			return err
+		}
+
+		if idempotencyKey != "" {
+			// Если результат не сохранился, ключ остается занятым и повторы получат
+			// OPERATION_IN_PROGRESS вместо повторного списания, пока резерв не устареет
+			if err := h.walletUsecase.CompleteIdempotencyKey(keyCtx, idempotencyKey, http.StatusOK, response); err != nil {
+				h.logger.Errorf("Failed to save idempotent response: key: %s, error: %v", idempotencyKey, err)
+			}
+		}
+
+		return c.JSONBlob(http.StatusOK, response)
 	}
 }
 
+const (
+	// maxOwnerIDLength и maxLabelLength совпадают с размером колонок в БД
+	maxOwnerIDLength = 255
+	maxLabelLength   = 255
+	// maxMetadataSize ограничение размера метаданных кошелька в байтах
+	maxMetadataSize = 16 << 10
+)
+
+type CreateWalletRequest struct {
+	// WalletID необязательный ID, выбранный клиентом: повтор запроса с ним вернет тот же кошелек
+	WalletID string          `json:"walletId,omitempty"`
+	OwnerID  string          `json:"ownerId,omitempty"`
+	Label    string          `json:"label,omitempty"`
+	Currency string          `json:"currency,omitempty"`
+	Metadata models.Metadata `json:"metadata,omitempty"`
+}
+
+// validate проверяет поля, которые не может проверить база
+func (r CreateWalletRequest) validate() error {
+	if len(r.OwnerID) > maxOwnerIDLength {
+		return fmt.Errorf("ownerId must be at most %d characters", maxOwnerIDLength)
+	}
+	if len(r.Label) > maxLabelLength {
+		return fmt.Errorf("label must be at most %d characters", maxLabelLength)
+	}
+	if len(r.Metadata) > maxMetadataSize {
+		return fmt.Errorf("metadata must be at most %d bytes", maxMetadataSize)
+	}
+	if len(r.Metadata) > 0 {
+		// Метаданные только объект: массив или скаляр потом не расширить новыми ключами
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(r.Metadata, &obj); err != nil {
+			return errors.New("metadata must be a JSON object")
+		}
+	}
+	return nil
+}
+
 func (h walletHandlers) CreateWallet() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		h.logger.Info("CreateWallet handler called")
 
 		ctx := c.Request().Context()
 
+		// Тело необязательно: без него создается анонимный кошелек в валюте по умолчанию
+		var req CreateWalletRequest
+		if err := c.Bind(&req); err != nil {
+			h.logger.Warn("Invalid request body")
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid request body",
+				"code":    "INVALID_REQUEST_BODY",
+				"message": "Check JSON structure",
+			})
+		}
+
+		if err := req.validate(); err != nil {
+			h.logger.Warnf("Invalid create wallet request: %v", err)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid request body",
+				"code":    "INVALID_REQUEST_BODY",
+				"message": err.Error(),
+			})
+		}
+
+		var walletUUID uuid.UUID
+		if req.WalletID != "" {
+			parsed, err := utils.ValidateUUID(req.WalletID)
+			if err != nil || parsed == uuid.Nil {
+				h.logger.Warnf("Invalid wallet ID: %s", req.WalletID)
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":   "invalid UUID format",
+					"code":    "INVALID_UUID",
+					"message": "walletId must be a valid non-nil UUID",
+				})
+			}
+			walletUUID = parsed
+		}
+
 		// Вызываем usecase для создания кошелька
-		walletID, err := h.walletUsecase.CreateWallet(ctx)
+		w, err := h.walletUsecase.CreateWallet(ctx, models.WalletParams{
+			WalletID: walletUUID,
+			OwnerID:  req.OwnerID,
+			Label:    req.Label,
+			Currency: req.Currency,
+			Metadata: req.Metadata,
+		})
 		if err != nil {
 			h.logger.Errorf("Failed to create wallet: %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error":   "wallet creation failed",
-				"message": "please try again later",
-			})
+			return err
 		}
 
-		h.logger.Infof("Wallet created successfully: %s", walletID)
-		return c.JSON(http.StatusCreated, map[string]string{
-			"wallet_id": walletID.String(),
+		h.logger.Infof("Wallet created successfully: %s", w.WalletID)
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"wallet_id": w.WalletID.String(),
+			"currency":  w.Currency,
+			"owner_id":  w.OwnerID,
+			"label":     w.Label,
+			"metadata":  w.Metadata,
 			"message":   "Wallet created successfully",
 		})
 	}
 }
+
+// List отдает кошельки клиента: GET /wallets?owner=<ownerId>
+func (h walletHandlers) List() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("List handler called")
+
+		ctx := c.Request().Context()
+
+		owner := c.QueryParam("owner")
+		if owner == "" || len(owner) > maxOwnerIDLength {
+			h.logger.Warnf("Invalid owner filter: %q", owner)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid query parameters",
+				"code":    "INVALID_FILTER",
+				"message": "owner query parameter is required",
+			})
+		}
+
+		wallets, err := h.walletUsecase.ListWallets(ctx, owner)
+		if err != nil {
+			h.logger.Errorf("Failed to list wallets of owner %s: %v", owner, err)
+			return err
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"wallets": wallets,
+		})
+	}
+}
+
+// Limits отдает действующие лимиты кошелька, 0 означает отсутствие ограничения
+func (h walletHandlers) Limits() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("Limits handler called")
+
+		ctx := c.Request().Context()
+
+		uuidStr := c.Param("uuid")
+		walletUUID, err := utils.ValidateUUID(uuidStr)
+		if err != nil {
+			h.logger.Warnf("Invalid UUID: %s", uuidStr)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid UUID format",
+				"code":    "INVALID_UUID",
+				"message": "UUID must be in valid format (e.g., 550e8400-e29b-41d4-a716-446655440000)",
+			})
+		}
+
+		limits, err := h.walletUsecase.GetLimits(ctx, walletUUID)
+		if err != nil {
+			h.logger.Errorf("Failed to get limits of wallet %s: %v", walletUUID, err)
+			return err
+		}
+
+		return c.JSON(http.StatusOK, limits)
+	}
+}
+
+// SetLimitsRequest собственные лимиты кошелька. Пропущенное или null поле
+// возвращает лимит по умолчанию, 0 снимает ограничение
+type SetLimitsRequest struct {
+	MaxOperationAmount     *int64 `json:"maxOperationAmount"`
+	MaxBalance             *int64 `json:"maxBalance"`
+	DailyWithdrawalLimit   *int64 `json:"dailyWithdrawalLimit"`
+	MonthlyWithdrawalLimit *int64 `json:"monthlyWithdrawalLimit"`
+}
+
+// SetLimits задает лимиты кошелька и отдает получившиеся действующие лимиты
+func (h walletHandlers) SetLimits() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("SetLimits handler called")
+
+		ctx := c.Request().Context()
+
+		uuidStr := c.Param("uuid")
+		walletUUID, err := utils.ValidateUUID(uuidStr)
+		if err != nil {
+			h.logger.Warnf("Invalid UUID: %s", uuidStr)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid UUID format",
+				"code":    "INVALID_UUID",
+				"message": "UUID must be in valid format (e.g., 550e8400-e29b-41d4-a716-446655440000)",
+			})
+		}
+
+		var req SetLimitsRequest
+		if err := c.Bind(&req); err != nil {
+			h.logger.Warn("Invalid request body")
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid request body",
+				"code":    "INVALID_REQUEST_BODY",
+				"message": "Check JSON structure",
+			})
+		}
+
+		limits, err := h.walletUsecase.SetLimits(ctx, &models.WalletLimits{
+			WalletID:               walletUUID,
+			MaxOperationAmount:     req.MaxOperationAmount,
+			MaxBalance:             req.MaxBalance,
+			DailyWithdrawalLimit:   req.DailyWithdrawalLimit,
+			MonthlyWithdrawalLimit: req.MonthlyWithdrawalLimit,
+		})
+		if err != nil {
+			h.logger.Errorf("Failed to set limits of wallet %s: %v", walletUUID, err)
+			return err
+		}
+
+		h.logger.Infof("Limits updated: wallet %s", walletUUID)
+		return c.JSON(http.StatusOK, limits)
+	}
+}
+
+// Freeze замораживает кошелек: операции по нему отклоняются до разморозки
+func (h walletHandlers) Freeze() echo.HandlerFunc {
+	return h.updateStatus(models.WalletStatusFrozen, "Wallet frozen successfully")
+}
+
+// Unfreeze возвращает замороженный кошелек в active
+func (h walletHandlers) Unfreeze() echo.HandlerFunc {
+	return h.updateStatus(models.WalletStatusActive, "Wallet unfrozen successfully")
+}
+
+// Close закрывает кошелек с нулевым балансом, закрытый кошелек вернуть нельзя
+func (h walletHandlers) Close() echo.HandlerFunc {
+	return h.updateStatus(models.WalletStatusClosed, "Wallet closed successfully")
+}
+
+func (h walletHandlers) updateStatus(status, message string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Infof("UpdateStatus handler called: status=%s", status)
+
+		ctx := c.Request().Context()
+
+		uuidStr := c.Param("uuid")
+		walletUUID, err := utils.ValidateUUID(uuidStr)
+		if err != nil {
+			h.logger.Warnf("Invalid UUID: %s", uuidStr)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid UUID format",
+				"code":    "INVALID_UUID",
+				"message": "UUID must be in valid format (e.g., 550e8400-e29b-41d4-a716-446655440000)",
+			})
+		}
+
+		w, err := h.walletUsecase.UpdateStatus(ctx, walletUUID, status)
+		if err != nil {
+			h.logger.Errorf("Failed to update status of wallet %s: %v", walletUUID, err)
+			return err
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{
+			"wallet_id": w.WalletID.String(),
+			"status":    w.Status,
+			"message":   message,
+		})
+	}
+}
+
+// LedgerCheck сверка главной книги для администраторов. Расхождение не ошибка запроса:
+// отчет отдается со статусом 200, а в лог пишется ошибка для алертинга
+func (h walletHandlers) LedgerCheck() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("LedgerCheck handler called")
+
+		check, err := h.walletUsecase.CheckLedger(c.Request().Context())
+		if err != nil {
+			h.logger.Errorf("Failed to check ledger: %v", err)
+			return err
+		}
+
+		if !check.Balanced {
+			h.logger.Errorf("Ledger is unbalanced: total=%d, unbalanced entries=%d, mismatched wallets=%d",
+				check.Total, len(check.UnbalancedEntries), len(check.MismatchedWallets))
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"ledger": check,
+		})
+	}
+}
+
+// CreateScheduleRequest запланированная операция над кошельком из пути запроса
+type CreateScheduleRequest struct {
+	OperationType string `json:"operationType" validate:"required,oneof=DEPOSIT WITHDRAW TRANSFER"`
+	Amount        int64  `json:"amount" validate:"gt=0"`
+	ToWalletID    string `json:"toWalletId,omitempty"`
+	// RunAt время первого или единственного запуска в RFC3339
+	RunAt time.Time `json:"runAt" validate:"required"`
+	// Recurrence пустая для разовой операции
+	Recurrence string `json:"recurrence,omitempty" validate:"omitempty,oneof=daily weekly monthly"`
+}
+
+// CreateSchedule планирует операцию на будущее, разовую или повторяющуюся
+func (h walletHandlers) CreateSchedule() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("CreateSchedule handler called")
+
+		ctx := c.Request().Context()
+
+		uuidStr := c.Param("uuid")
+		walletUUID, err := utils.ValidateUUID(uuidStr)
+		if err != nil {
+			h.logger.Warnf("Invalid UUID: %s", uuidStr)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid UUID format",
+				"code":    "INVALID_UUID",
+				"message": "UUID must be in valid format (e.g., 550e8400-e29b-41d4-a716-446655440000)",
+			})
+		}
+
+		var req CreateScheduleRequest
+		if err := c.Bind(&req); err != nil {
+			h.logger.Warn("Invalid request body")
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid request body",
+				"code":    "INVALID_REQUEST_BODY",
+				"message": "Check JSON structure, runAt must be an RFC3339 timestamp",
+			})
+		}
+
+		if err := c.Validate(&req); err != nil {
+			h.logger.Warnf("Invalid schedule request: %v", err)
+			return err
+		}
+
+		schedule := &models.Schedule{
+			WalletID:      walletUUID,
+			OperationType: req.OperationType,
+			Amount:        req.Amount,
+			Recurrence:    req.Recurrence,
+			StartAt:       req.RunAt,
+		}
+		if req.OperationType == models.OperationTypeTransfer {
+			toWalletUUID, err := utils.ValidateUUID(req.ToWalletID)
+			if err != nil {
+				h.logger.Warnf("Invalid destination UUID: %s", req.ToWalletID)
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error":   "invalid UUID format",
+					"code":    "INVALID_UUID",
+					"message": "toWalletId must be a valid UUID for TRANSFER operations",
+				})
+			}
+			schedule.ToWalletID = &toWalletUUID
+		}
+
+		created, err := h.walletUsecase.CreateSchedule(ctx, schedule)
+		if err != nil {
+			h.logger.Errorf("Failed to create schedule for wallet %s: %v", walletUUID, err)
+			return err
+		}
+
+		h.logger.Infof("Schedule created: %s, wallet %s", created.ID, walletUUID)
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"message":  "Schedule created successfully",
+			"schedule": created,
+		})
+	}
+}
+
+// Schedules отдает расписания кошелька
+func (h walletHandlers) Schedules() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("Schedules handler called")
+
+		ctx := c.Request().Context()
+
+		uuidStr := c.Param("uuid")
+		walletUUID, err := utils.ValidateUUID(uuidStr)
+		if err != nil {
+			h.logger.Warnf("Invalid UUID: %s", uuidStr)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error":   "invalid UUID format",
+				"code":    "INVALID_UUID",
+				"message": "UUID must be in valid format (e.g., 550e8400-e29b-41d4-a716-446655440000)",
+			})
+		}
+
+		schedules, err := h.walletUsecase.ListSchedules(ctx, walletUUID)
+		if err != nil {
+			h.logger.Errorf("Failed to list schedules of wallet %s: %v", walletUUID, err)
+			return err
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"schedules": schedules,
+		})
+	}
+}
+
+// CancelSchedule отменяет будущие запуски расписания
+func (h walletHandlers) CancelSchedule() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("CancelSchedule handler called")
+
+		ctx := c.Request().Context()
+
+		walletUUID, scheduleUUID, ok := h.scheduleParams(c)
+		if !ok {
+			return invalidScheduleParams(c)
+		}
+
+		schedule, err := h.walletUsecase.CancelSchedule(ctx, walletUUID, scheduleUUID)
+		if err != nil {
+			h.logger.Errorf("Failed to cancel schedule %s: %v", scheduleUUID, err)
+			return err
+		}
+
+		h.logger.Infof("Schedule cancelled: %s, wallet %s", scheduleUUID, walletUUID)
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message":  "Schedule cancelled successfully",
+			"schedule": schedule,
+		})
+	}
+}
+
+// ScheduleExecutions отдает журнал запусков расписания, последние первыми
+func (h walletHandlers) ScheduleExecutions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.logger.Info("ScheduleExecutions handler called")
+
+		ctx := c.Request().Context()
+
+		walletUUID, scheduleUUID, ok := h.scheduleParams(c)
+		if !ok {
+			return invalidScheduleParams(c)
+		}
+
+		executions, err := h.walletUsecase.GetScheduleExecutions(ctx, walletUUID, scheduleUUID)
+		if err != nil {
+			h.logger.Errorf("Failed to fetch executions of schedule %s: %v", scheduleUUID, err)
+			return err
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"executions": executions,
+		})
+	}
+}
+
+// scheduleParams разбирает ID кошелька и расписания из пути запроса
+func (h walletHandlers) scheduleParams(c echo.Context) (uuid.UUID, uuid.UUID, bool) {
+	walletUUID, err := utils.ValidateUUID(c.Param("uuid"))
+	if err != nil {
+		h.logger.Warnf("Invalid UUID: %s", c.Param("uuid"))
+		return uuid.Nil, uuid.Nil, false
+	}
+	scheduleUUID, err := utils.ValidateUUID(c.Param("schedule"))
+	if err != nil {
+		h.logger.Warnf("Invalid schedule UUID: %s", c.Param("schedule"))
+		return uuid.Nil, uuid.Nil, false
+	}
+	return walletUUID, scheduleUUID, true
+}
+
+func invalidScheduleParams(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, map[string]string{
+		"error":   "invalid UUID format",
+		"code":    "INVALID_UUID",
+		"message": "wallet and schedule IDs must be valid UUIDs",
+	})
+}
@@ -2,23 +2,44 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
 	"github.com/22Fariz22/wallet/internal/wallet"
 	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
-func TestDisplayHandler(t *testing.T) {
+// structValidator валидатор для тестов, в сервере его роль играет server.CustomValidator
+type structValidator struct {
+	validate *validator.Validate
+}
+
+func (v structValidator) Validate(i interface{}) error {
+	return v.validate.Struct(i)
+}
+
+// newTestEcho echo с валидатором, как при запуске сервера
+func newTestEcho() *echo.Echo {
 	e := echo.New()
+	e.Validator = structValidator{validate: validator.New()}
+	return e
+}
+
+func TestDisplayHandler(t *testing.T) {
+	e := newTestEcho()
 	mockUsecase := new(wallet.MockWalletUsecase)
 	cfg := &config.Config{}
 	log := logger.NewMockLogger()
@@ -26,7 +47,8 @@ func TestDisplayHandler(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		walletID := uuid.New()
-		mockUsecase.On("Display", mock.Anything, walletID).Return(int64(1000), nil)
+		mockUsecase.On("Display", mock.Anything, walletID).
+			Return(&models.Wallet{WalletID: walletID, Amount: 1000, Currency: "USD", Version: 4}, nil)
 
 		req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -39,9 +61,33 @@ func TestDisplayHandler(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
 		assert.Contains(t, rec.Body.String(), "1000")
+		assert.Contains(t, rec.Body.String(), `"formatted":"10.00"`)
+		assert.Contains(t, rec.Body.String(), "USD")
+		assert.Equal(t, `"4"`, rec.Header().Get(HeaderETag))
 		mockUsecase.AssertExpectations(t)
 	})
 
+	t.Run("Available And Posted", func(t *testing.T) {
+		walletID := uuid.New()
+		mockUsecase.On("Display", mock.Anything, walletID).
+			Return(&models.Wallet{WalletID: walletID, Amount: 1000, Held: 300, Currency: "USD"}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.Display()(c)
+
+		var resp map[string]interface{}
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, float64(1000), resp["posted"])
+		assert.Equal(t, float64(700), resp["available"])
+		assert.Equal(t, float64(300), resp["held"])
+	})
+
 	t.Run("Invalid UUID", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/wallets/invalid-uuid", nil)
 		rec := httptest.NewRecorder()
@@ -58,7 +104,23 @@ func TestDisplayHandler(t *testing.T) {
 
 	t.Run("Error fetching balance", func(t *testing.T) {
 		walletID := uuid.New()
-		mockUsecase.On("Display", mock.Anything, walletID).Return(int64(0), errors.New("database error"))
+		mockUsecase.On("Display", mock.Anything, walletID).Return(nil, errors.New("database error"))
+
+		req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.Display()(c)
+
+		assert.EqualError(t, err, "database error")
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Wallet not found", func(t *testing.T) {
+		walletID := uuid.New()
+		mockUsecase.On("Display", mock.Anything, walletID).Return(nil, wallet.ErrWalletNotFound)
 
 		req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -68,15 +130,90 @@ func TestDisplayHandler(t *testing.T) {
 
 		err := handler.Display()(c)
 
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
+		mockUsecase.AssertExpectations(t)
+	})
+}
+
+func TestTransactionsHandler(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	t.Run("Success With Filters", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cursor := models.TransactionCursor{CreatedAt: from.Add(time.Hour), ID: uuid.New()}
+		expected := models.TransactionFilter{
+			Type:      models.TransactionTypeDeposit,
+			From:      &from,
+			After:     &cursor,
+			Limit:     20,
+			Ascending: true,
+		}
+		page := &models.TransactionPage{
+			Transactions: []models.Transaction{{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeDeposit, Amount: 10}},
+			NextCursor:   "next",
+		}
+		mockUsecase.On("GetTransactions", mock.Anything, walletID, expected).Return(page, nil).Once()
+
+		query := "?type=DEPOSIT&from=2024-01-01T00:00:00Z&limit=20&sort=asc&cursor=" + cursor.Encode()
+		req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String()+"/transactions"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.Transactions()(c)
+
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusInternalServerError, rec.Code)
-		assert.Contains(t, rec.Body.String(), "internal server error")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"next_cursor":"next"`)
 		mockUsecase.AssertExpectations(t)
 	})
+
+	t.Run("Invalid Filter", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String()+"/transactions?sort=sideways", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.Transactions()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "INVALID_FILTER")
+	})
+
+	t.Run("Invalid Cursor", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String()+"/transactions?cursor=%21%21", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.Transactions()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "cursor is invalid")
+	})
 }
 
 func TestOperationHandler(t *testing.T) {
-	e := echo.New()
+	e := newTestEcho()
 	mockUsecase := new(wallet.MockWalletUsecase)
 	cfg := &config.Config{}
 	log := logger.NewMockLogger()
@@ -91,7 +228,14 @@ func TestOperationHandler(t *testing.T) {
 		}
 		jsonData, _ := json.Marshal(requestBody)
 
-		mockUsecase.On("Deposit", mock.Anything, walletID, int64(500)).Return(nil)
+		transaction := &models.Transaction{
+			ID:           uuid.New(),
+			WalletID:     walletID,
+			Type:         models.TransactionTypeDeposit,
+			Amount:       500,
+			BalanceAfter: 1500,
+		}
+		mockUsecase.On("Deposit", mock.Anything, walletID, int64(500)).Return(transaction, nil)
 
 		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -102,6 +246,8 @@ func TestOperationHandler(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), transaction.ID.String())
+		assert.Contains(t, rec.Body.String(), "1500")
 		mockUsecase.AssertExpectations(t)
 	})
 
@@ -136,7 +282,76 @@ func TestOperationHandler(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Contains(t, rec.Body.String(), "operationType must be 'DEPOSIT' or 'WITHDRAW'")
+		assert.Contains(t, rec.Body.String(), "operationType must be 'DEPOSIT', 'WITHDRAW', 'TRANSFER', 'REVERSE', 'HOLD', 'CAPTURE' or 'RELEASE'")
+	})
+
+	t.Run("Success Transfer", func(t *testing.T) {
+		walletID, toWalletID := uuid.New(), uuid.New()
+		requestBody := map[string]interface{}{
+			"walletId":      walletID.String(),
+			"toWalletId":    toWalletID.String(),
+			"operationType": "TRANSFER",
+			"amount":        250,
+		}
+		jsonData, _ := json.Marshal(requestBody)
+
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeTransferOut, Amount: 250}
+		mockUsecase.On("Transfer", mock.Anything, walletID, toWalletID, int64(250)).Return(transaction, nil)
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Operation()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), models.TransactionTypeTransferOut)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Currency Mismatch", func(t *testing.T) {
+		walletID := uuid.New()
+		requestBody := map[string]interface{}{
+			"walletId":      walletID.String(),
+			"operationType": "DEPOSIT",
+			"amount":        100,
+			"currency":      "USD",
+		}
+		jsonData, _ := json.Marshal(requestBody)
+
+		mockUsecase.On("CheckCurrency", mock.Anything, walletID, "USD").Return(wallet.ErrCurrencyMismatch)
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Operation()(c)
+
+		assert.ErrorIs(t, err, wallet.ErrCurrencyMismatch)
+		mockUsecase.AssertNotCalled(t, "Deposit", mock.Anything, walletID, int64(100))
+	})
+
+	t.Run("Transfer Without Destination", func(t *testing.T) {
+		requestBody := map[string]interface{}{
+			"walletId":      uuid.New().String(),
+			"operationType": "TRANSFER",
+			"amount":        250,
+		}
+		jsonData, _ := json.Marshal(requestBody)
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Operation()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "toWalletId")
 	})
 
 	t.Run("Failed Withdraw", func(t *testing.T) {
@@ -148,7 +363,7 @@ func TestOperationHandler(t *testing.T) {
 		}
 		jsonData, _ := json.Marshal(requestBody)
 
-		mockUsecase.On("Withdraw", mock.Anything, walletID, int64(200)).Return(errors.New("insufficient funds"))
+		mockUsecase.On("Withdraw", mock.Anything, walletID, int64(200)).Return(nil, errors.New("db error"))
 
 		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -157,55 +372,938 @@ func TestOperationHandler(t *testing.T) {
 
 		err := handler.Operation()(c)
 
+		assert.EqualError(t, err, "db error")
+		mockUsecase.AssertExpectations(t)
+	})
+}
+
+func TestOperationHandler_Reverse(t *testing.T) {
+	e := newTestEcho()
+	mockUsecase := new(wallet.MockWalletUsecase)
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+	handler := NewWalletHandler(cfg, mockUsecase, log)
+
+	operation := func(body string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, handler.Operation()(e.NewContext(req, rec))
+	}
+
+	t.Run("Partial Refund", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeReversal, Amount: 40, ReversalOf: &originalID}
+		mockUsecase.On("Reverse", mock.Anything, walletID, originalID, int64(40)).Return(transaction, nil).Once()
+
+		rec, err := operation(fmt.Sprintf(`{"walletId":"%s","operationType":"REVERSE","transactionId":"%s","amount":40}`, walletID, originalID))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"reversal_of":"`+originalID.String()+`"`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Without Transaction ID", func(t *testing.T) {
+		rec, err := operation(fmt.Sprintf(`{"walletId":"%s","operationType":"REVERSE","amount":40}`, uuid.New()))
+
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusInternalServerError, rec.Code)
-		assert.Contains(t, rec.Body.String(), "operation failed")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "transactionId must be a valid UUID")
+	})
+
+	t.Run("Already Reversed", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+		mockUsecase.On("Reverse", mock.Anything, walletID, originalID, int64(40)).Return(nil, wallet.ErrAlreadyReversed).Once()
+
+		_, err := operation(fmt.Sprintf(`{"walletId":"%s","operationType":"REVERSE","transactionId":"%s","amount":40}`, walletID, originalID))
+
+		assert.ErrorIs(t, err, wallet.ErrAlreadyReversed)
 		mockUsecase.AssertExpectations(t)
 	})
 }
 
-func TestCreateWalletHandler(t *testing.T) {
-	e := echo.New()
+func TestOperationHandler_IfMatch(t *testing.T) {
+	e := newTestEcho()
 	cfg := &config.Config{}
 	log := logger.NewMockLogger()
 
-	t.Run("Success", func(t *testing.T) {
+	deposit := func(handler wallet.Handlers, walletID uuid.UUID, ifMatch string) (*httptest.ResponseRecorder, error) {
+		body := fmt.Sprintf(`{"walletId":"%s","operationType":"DEPOSIT","amount":100}`, walletID)
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIfMatch, ifMatch)
+		rec := httptest.NewRecorder()
+		return rec, handler.Operation()(e.NewContext(req, rec))
+	}
+
+	t.Run("Version Passed To Usecase", func(t *testing.T) {
 		mockUsecase := new(wallet.MockWalletUsecase)
 		handler := NewWalletHandler(cfg, mockUsecase, log)
 
 		walletID := uuid.New()
-		mockUsecase.On("CreateWallet", mock.Anything).Return(walletID, nil).Once()
+		mockUsecase.On("Deposit", mock.MatchedBy(func(ctx context.Context) bool {
+			version, ok := wallet.ExpectedVersion(ctx)
+			return ok && version == 3
+		}), walletID, int64(100)).Return(&models.Transaction{ID: uuid.New(), WalletID: walletID}, nil).Once()
 
-		req := httptest.NewRequest(http.MethodPost, "/new", nil)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+		rec, err := deposit(handler, walletID, `"3"`)
 
-		err := handler.CreateWallet()(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Any Version", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		mockUsecase.On("Deposit", mock.MatchedBy(func(ctx context.Context) bool {
+			_, ok := wallet.ExpectedVersion(ctx)
+			return !ok
+		}), walletID, int64(100)).Return(&models.Transaction{ID: uuid.New(), WalletID: walletID}, nil).Once()
+
+		rec, err := deposit(handler, walletID, "*")
 
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusCreated, rec.Code)
-		assert.Contains(t, rec.Body.String(), walletID.String())
-		assert.Contains(t, rec.Body.String(), "Wallet created successfully")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Version Changed", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
 
+		walletID := uuid.New()
+		mockUsecase.On("Deposit", mock.Anything, walletID, int64(100)).Return(nil, wallet.ErrVersionMismatch).Once()
+
+		_, err := deposit(handler, walletID, `"3"`)
+
+		assert.ErrorIs(t, err, wallet.ErrVersionMismatch)
 		mockUsecase.AssertExpectations(t)
 	})
 
-	t.Run("Failure", func(t *testing.T) {
+	t.Run("Weak ETag", func(t *testing.T) {
 		mockUsecase := new(wallet.MockWalletUsecase)
 		handler := NewWalletHandler(cfg, mockUsecase, log)
 
-		mockUsecase.On("CreateWallet", mock.Anything).Return(uuid.UUID{}, errors.New("database error")).Once()
+		rec, err := deposit(handler, uuid.New(), `W/"3"`)
 
-		req := httptest.NewRequest(http.MethodPost, "/new", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "INVALID_IF_MATCH")
+		mockUsecase.AssertNotCalled(t, "Deposit")
+	})
+}
+
+func TestOperationHandler_Holds(t *testing.T) {
+	e := newTestEcho()
+	mockUsecase := new(wallet.MockWalletUsecase)
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+	handler := NewWalletHandler(cfg, mockUsecase, log)
+
+	operation := func(body string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+		return rec, handler.Operation()(e.NewContext(req, rec))
+	}
 
-		err := handler.CreateWallet()(c)
+	t.Run("Hold", func(t *testing.T) {
+		walletID := uuid.New()
+		hold := &models.Hold{ID: uuid.New(), WalletID: walletID, Amount: 300, Status: models.HoldStatusActive}
+		mockUsecase.On("Hold", mock.Anything, walletID, int64(300)).Return(hold, nil).Once()
+
+		rec, err := operation(fmt.Sprintf(`{"walletId":"%s","operationType":"HOLD","amount":300}`, walletID))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"hold":{"id":"`+hold.ID.String())
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Partial Capture", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeCapture, Amount: 100}
+		mockUsecase.On("Capture", mock.Anything, walletID, holdID, int64(100)).Return(transaction, nil).Once()
+
+		rec, err := operation(fmt.Sprintf(`{"walletId":"%s","operationType":"CAPTURE","holdId":"%s","amount":100}`, walletID, holdID))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"type":"CAPTURE"`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Release Without Amount", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+		hold := &models.Hold{ID: holdID, WalletID: walletID, Amount: 200, Status: models.HoldStatusReleased}
+		mockUsecase.On("Release", mock.Anything, walletID, holdID).Return(hold, nil).Once()
+
+		rec, err := operation(fmt.Sprintf(`{"walletId":"%s","operationType":"RELEASE","holdId":"%s"}`, walletID, holdID))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"released"`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Capture Without Hold ID", func(t *testing.T) {
+		rec, err := operation(fmt.Sprintf(`{"walletId":"%s","operationType":"CAPTURE","amount":100}`, uuid.New()))
 
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusInternalServerError, rec.Code)
-		assert.Contains(t, rec.Body.String(), "wallet creation failed")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "holdId must be a valid UUID")
+	})
+
+	t.Run("Hold Not Active", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+		mockUsecase.On("Capture", mock.Anything, walletID, holdID, int64(50)).Return(nil, wallet.ErrHoldNotActive).Once()
+
+		_, err := operation(fmt.Sprintf(`{"walletId":"%s","operationType":"CAPTURE","holdId":"%s","amount":50}`, walletID, holdID))
+
+		assert.ErrorIs(t, err, wallet.ErrHoldNotActive)
+		mockUsecase.AssertExpectations(t)
+	})
+}
+
+func TestOperationHandler_Validation(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{name: "Zero Amount", body: `{"walletId":"%s","operationType":"DEPOSIT","amount":0}`, field: "Amount"},
+		{name: "Negative Amount", body: `{"walletId":"%s","operationType":"DEPOSIT","amount":-100}`, field: "Amount"},
+		{name: "Bad Currency", body: `{"walletId":"%s","operationType":"WITHDRAW","amount":100,"currency":"RUBLE"}`, field: "Currency"},
+		{name: "Capture Without Amount", body: `{"walletId":"%s","operationType":"CAPTURE","holdId":"` + uuid.NewString() + `"}`, field: "Amount"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUsecase := new(wallet.MockWalletUsecase)
+			handler := NewWalletHandler(cfg, mockUsecase, log)
+
+			req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBufferString(fmt.Sprintf(tt.body, uuid.New())))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := handler.Operation()(c)
+
+			var validationErrs validator.ValidationErrors
+			assert.ErrorAs(t, err, &validationErrs)
+			assert.Len(t, validationErrs, 1)
+			assert.Equal(t, tt.field, validationErrs[0].Field())
+			// До usecase невалидная сумма не доходит
+			mockUsecase.AssertNotCalled(t, "Deposit", mock.Anything, mock.Anything, mock.Anything)
+			mockUsecase.AssertNotCalled(t, "Withdraw", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestOperationHandler_InsufficientFunds(t *testing.T) {
+	e := newTestEcho()
+	mockUsecase := new(wallet.MockWalletUsecase)
+	handler := NewWalletHandler(&config.Config{}, mockUsecase, logger.NewMockLogger())
+
+	walletID := uuid.New()
+	requestBody := map[string]interface{}{
+		"walletID":      walletID.String(),
+		"operationType": "WITHDRAW",
+		"amount":        1000,
+	}
+	jsonData, _ := json.Marshal(requestBody)
+
+	mockUsecase.On("Withdraw", mock.Anything, walletID, int64(1000)).
+		Return(nil, fmt.Errorf("withdraw: %w", wallet.ErrInsufficientFunds))
+
+	req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := handler.Operation()(c)
+
+	assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+	mockUsecase.AssertExpectations(t)
+}
+
+func TestOperationHandler_Idempotency(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
 
+	walletID := uuid.New()
+	requestBody := map[string]interface{}{
+		"walletId":      walletID.String(),
+		"operationType": "DEPOSIT",
+		"amount":        300,
+	}
+	jsonData, _ := json.Marshal(requestBody)
+
+	t.Run("First request is executed and stored", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeDeposit, Amount: 300}
+		mockUsecase.On("ReserveIdempotencyKey", mock.Anything, "key-1", mock.AnythingOfType("string")).Return(nil, nil).Once()
+		mockUsecase.On("Deposit", mock.Anything, walletID, int64(300)).Return(transaction, nil).Once()
+		mockUsecase.On("CompleteIdempotencyKey", mock.Anything, "key-1", http.StatusOK, mock.Anything).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, "key-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Operation()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), transaction.ID.String())
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Replay returns stored response", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		stored := &models.IdempotencyKey{Key: "key-1", StatusCode: http.StatusOK, Response: []byte(`{"message":"Operation successful"}`)}
+		mockUsecase.On("ReserveIdempotencyKey", mock.Anything, "key-1", mock.AnythingOfType("string")).Return(stored, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, "key-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Operation()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "true", rec.Header().Get(HeaderIdempotentReplayed))
+		assert.JSONEq(t, `{"message":"Operation successful"}`, rec.Body.String())
+		mockUsecase.AssertNotCalled(t, "Deposit", mock.Anything, mock.Anything, mock.Anything)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Failed operation releases the key", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"walletId":      walletID.String(),
+			"operationType": "WITHDRAW",
+			"amount":        300,
+			"requestId":     "key-2",
+		})
+		mockUsecase.On("ReserveIdempotencyKey", mock.Anything, "key-2", mock.AnythingOfType("string")).Return(nil, nil).Once()
+		mockUsecase.On("Withdraw", mock.Anything, walletID, int64(300)).Return(nil, wallet.ErrInsufficientFunds).Once()
+		mockUsecase.On("ReleaseIdempotencyKey", mock.Anything, "key-2").Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Operation()(c)
+
+		assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Key is completed after client disconnect", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		reqCtx, cancel := context.WithCancel(context.Background())
+		notCancelled := mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() == nil })
+
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeDeposit, Amount: 300}
+		mockUsecase.On("ReserveIdempotencyKey", mock.Anything, "key-3", mock.AnythingOfType("string")).Return(nil, nil).Once()
+		// Клиент отключился, пока операция выполнялась
+		mockUsecase.On("Deposit", mock.Anything, walletID, int64(300)).
+			Run(func(mock.Arguments) { cancel() }).
+			Return(transaction, nil).Once()
+		mockUsecase.On("CompleteIdempotencyKey", notCancelled, "key-3", http.StatusOK, mock.Anything).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData)).WithContext(reqCtx)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, "key-3")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Operation()(c)
+
+		assert.NoError(t, err)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Conflicting payload is rejected", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		mockUsecase.On("ReserveIdempotencyKey", mock.Anything, "key-1", mock.AnythingOfType("string")).
+			Return(nil, wallet.ErrIdempotencyKeyReused).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewBuffer(jsonData))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, "key-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Operation()(c)
+
+		assert.ErrorIs(t, err, wallet.ErrIdempotencyKeyReused)
+		mockUsecase.AssertExpectations(t)
+	})
+}
+
+func TestCreateWalletHandler(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	t.Run("Success", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		mockUsecase.On("CreateWallet", mock.Anything, models.WalletParams{}).
+			Return(&models.Wallet{WalletID: walletID, Currency: "RUB"}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/new", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.CreateWallet()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), walletID.String())
+		assert.Contains(t, rec.Body.String(), "Wallet created successfully")
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("With Currency", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		mockUsecase.On("CreateWallet", mock.Anything, models.WalletParams{Currency: "EUR"}).
+			Return(&models.Wallet{WalletID: walletID, Currency: "EUR"}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/new", bytes.NewBufferString(`{"currency":"EUR"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.CreateWallet()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), "EUR")
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("With Owner And Metadata", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		params := models.WalletParams{OwnerID: "user-1", Label: "savings", Metadata: models.Metadata(`{"tier":"gold"}`)}
+		mockUsecase.On("CreateWallet", mock.Anything, params).
+			Return(&models.Wallet{WalletID: walletID, Currency: "RUB", OwnerID: "user-1", Label: "savings", Metadata: params.Metadata}, nil).Once()
+
+		body := `{"ownerId":"user-1","label":"savings","metadata":{"tier":"gold"}}`
+		req := httptest.NewRequest(http.MethodPost, "/new", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.CreateWallet()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "user-1", resp["owner_id"])
+		assert.Equal(t, "savings", resp["label"])
+		assert.Equal(t, map[string]interface{}{"tier": "gold"}, resp["metadata"])
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("With Client Wallet ID", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		mockUsecase.On("CreateWallet", mock.Anything, models.WalletParams{WalletID: walletID}).
+			Return(&models.Wallet{WalletID: walletID, Currency: "RUB"}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/new", bytes.NewBufferString(fmt.Sprintf(`{"walletId":%q}`, walletID)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.CreateWallet()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), walletID.String())
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Wallet ID Taken", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		mockUsecase.On("CreateWallet", mock.Anything, models.WalletParams{WalletID: walletID, OwnerID: "user-1"}).
+			Return(nil, wallet.ErrWalletExists).Once()
+
+		body := fmt.Sprintf(`{"walletId":%q,"ownerId":"user-1"}`, walletID)
+		req := httptest.NewRequest(http.MethodPost, "/new", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.CreateWallet()(c)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletExists)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Invalid Request", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body string
+			code string
+		}{
+			{name: "Metadata Not Object", body: `{"metadata":[1,2]}`, code: "INVALID_REQUEST_BODY"},
+			{name: "Metadata Scalar", body: `{"metadata":"x"}`, code: "INVALID_REQUEST_BODY"},
+			{name: "Metadata Too Large", body: fmt.Sprintf(`{"metadata":{"k":"%s"}}`, bytes.Repeat([]byte("a"), maxMetadataSize)), code: "INVALID_REQUEST_BODY"},
+			{name: "Owner Too Long", body: fmt.Sprintf(`{"ownerId":"%s"}`, bytes.Repeat([]byte("a"), maxOwnerIDLength+1)), code: "INVALID_REQUEST_BODY"},
+			{name: "Label Too Long", body: fmt.Sprintf(`{"label":"%s"}`, bytes.Repeat([]byte("a"), maxLabelLength+1)), code: "INVALID_REQUEST_BODY"},
+			{name: "Invalid Wallet ID", body: `{"walletId":"not-a-uuid"}`, code: "INVALID_UUID"},
+			{name: "Nil Wallet ID", body: fmt.Sprintf(`{"walletId":%q}`, uuid.Nil), code: "INVALID_UUID"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockUsecase := new(wallet.MockWalletUsecase)
+				handler := NewWalletHandler(cfg, mockUsecase, log)
+
+				req := httptest.NewRequest(http.MethodPost, "/new", bytes.NewBufferString(tt.body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				err := handler.CreateWallet()(c)
+
+				assert.NoError(t, err)
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+				assert.Contains(t, rec.Body.String(), tt.code)
+				mockUsecase.AssertNotCalled(t, "CreateWallet", mock.Anything, mock.Anything)
+			})
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		mockUsecase.On("CreateWallet", mock.Anything, models.WalletParams{}).Return(nil, errors.New("database error")).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/new", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.CreateWallet()(c)
+
+		assert.EqualError(t, err, "database error")
+
+		mockUsecase.AssertExpectations(t)
+	})
+}
+
+func TestListHandler(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	t.Run("Success", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		wallets := []models.Wallet{
+			{WalletID: uuid.New(), Amount: 100, Currency: "RUB", Status: models.WalletStatusActive, OwnerID: "user-1", Label: "main"},
+			{WalletID: uuid.New(), Currency: "USD", Status: models.WalletStatusActive, OwnerID: "user-1"},
+		}
+		mockUsecase.On("ListWallets", mock.Anything, "user-1").Return(wallets, nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/wallets?owner=user-1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.List()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp struct {
+			Wallets []models.Wallet `json:"wallets"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Len(t, resp.Wallets, 2)
+		assert.Equal(t, wallets[0].WalletID, resp.Wallets[0].WalletID)
+		assert.Equal(t, "main", resp.Wallets[0].Label)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Missing Owner", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		req := httptest.NewRequest(http.MethodGet, "/wallets", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.List()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "INVALID_FILTER")
+		mockUsecase.AssertNotCalled(t, "ListWallets", mock.Anything, mock.Anything)
+	})
+}
+
+func TestLimitsHandlers(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	t.Run("Get", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		maxOperation, unlimited := int64(1000), int64(0)
+		mockUsecase.On("GetLimits", mock.Anything, walletID).Return(&models.WalletLimits{
+			WalletID:               walletID,
+			MaxOperationAmount:     &maxOperation,
+			MaxBalance:             &unlimited,
+			DailyWithdrawalLimit:   &unlimited,
+			MonthlyWithdrawalLimit: &unlimited,
+		}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.Limits()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"max_operation_amount":1000`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		daily := int64(5000)
+		mockUsecase.On("SetLimits", mock.Anything, &models.WalletLimits{WalletID: walletID, DailyWithdrawalLimit: &daily}).
+			Return(&models.WalletLimits{WalletID: walletID, DailyWithdrawalLimit: &daily}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPut, "/", bytes.NewBufferString(`{"dailyWithdrawalLimit":5000,"maxBalance":null}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.SetLimits()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"daily_withdrawal_limit":5000`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Set Invalid UUID", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		req := httptest.NewRequest(http.MethodPut, "/", bytes.NewBufferString(`{}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues("invalid-uuid")
+
+		err := handler.SetLimits()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		mockUsecase.AssertNotCalled(t, "SetLimits", mock.Anything, mock.Anything)
+	})
+}
+
+func TestLedgerCheckHandler(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	t.Run("Balanced", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		mockUsecase.On("CheckLedger", mock.Anything).Return(&models.LedgerCheck{
+			Balanced:          true,
+			UnbalancedEntries: []uuid.UUID{},
+			MismatchedWallets: []uuid.UUID{},
+			SystemAccounts:    map[string]int64{"funding": -300, "payout": 100},
+		}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.LedgerCheck()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"balanced":true`)
+		assert.Contains(t, rec.Body.String(), `"funding":-300`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Unbalanced", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		mockUsecase.On("CheckLedger", mock.Anything).Return(&models.LedgerCheck{
+			UnbalancedEntries: []uuid.UUID{},
+			MismatchedWallets: []uuid.UUID{walletID},
+			SystemAccounts:    map[string]int64{},
+		}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.LedgerCheck()(c)
+
+		// Расхождение в книге возвращается отчетом, а не ошибкой запроса
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"balanced":false`)
+		assert.Contains(t, rec.Body.String(), walletID.String())
+		mockUsecase.AssertExpectations(t)
+	})
+}
+
+func TestUpdateStatusHandlers(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	t.Run("Freeze", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		mockUsecase.On("UpdateStatus", mock.Anything, walletID, models.WalletStatusFrozen).
+			Return(&models.Wallet{WalletID: walletID, Status: models.WalletStatusFrozen}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/admin/wallets/:uuid/freeze")
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.Freeze()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"frozen"`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Close With Balance", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID := uuid.New()
+		mockUsecase.On("UpdateStatus", mock.Anything, walletID, models.WalletStatusClosed).
+			Return(nil, wallet.ErrWalletNotEmpty).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+
+		err := handler.Close()(c)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotEmpty)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Invalid UUID", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues("invalid-uuid")
+
+		err := handler.Unfreeze()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		mockUsecase.AssertNotCalled(t, "UpdateStatus")
+	})
+}
+
+func TestScheduleHandlers(t *testing.T) {
+	e := newTestEcho()
+	cfg := &config.Config{}
+	log := logger.NewMockLogger()
+
+	createSchedule := func(handler wallet.Handlers, walletID uuid.UUID, body string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid")
+		c.SetParamValues(walletID.String())
+		return rec, handler.CreateSchedule()(c)
+	}
+
+	t.Run("Create Recurring Transfer", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID, toWalletID := uuid.New(), uuid.New()
+		runAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		mockUsecase.On("CreateSchedule", mock.Anything, mock.MatchedBy(func(s *models.Schedule) bool {
+			return s.WalletID == walletID && *s.ToWalletID == toWalletID && s.StartAt.Equal(runAt) && s.Recurrence == models.RecurrenceMonthly
+		})).Return(&models.Schedule{ID: uuid.New(), WalletID: walletID, Status: models.ScheduleStatusActive}, nil).Once()
+
+		rec, err := createSchedule(handler, walletID, fmt.Sprintf(
+			`{"operationType":"TRANSFER","amount":500,"toWalletId":"%s","runAt":"%s","recurrence":"monthly"}`,
+			toWalletID, runAt.Format(time.RFC3339)))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"active"`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Create Unknown Recurrence", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		_, err := createSchedule(handler, uuid.New(),
+			`{"operationType":"DEPOSIT","amount":500,"runAt":"2030-01-01T00:00:00Z","recurrence":"hourly"}`)
+
+		var validationErrs validator.ValidationErrors
+		assert.ErrorAs(t, err, &validationErrs)
+		assert.Equal(t, "Recurrence", validationErrs[0].Field())
+		mockUsecase.AssertNotCalled(t, "CreateSchedule")
+	})
+
+	t.Run("Create Transfer Without Destination", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		rec, err := createSchedule(handler, uuid.New(), `{"operationType":"TRANSFER","amount":500,"runAt":"2030-01-01T00:00:00Z"}`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "toWalletId must be a valid UUID")
+		mockUsecase.AssertNotCalled(t, "CreateSchedule")
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID, scheduleID := uuid.New(), uuid.New()
+		mockUsecase.On("CancelSchedule", mock.Anything, walletID, scheduleID).
+			Return(&models.Schedule{ID: scheduleID, WalletID: walletID, Status: models.ScheduleStatusCancelled}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid", "schedule")
+		c.SetParamValues(walletID.String(), scheduleID.String())
+
+		err := handler.CancelSchedule()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"cancelled"`)
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("Cancel Invalid Schedule UUID", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid", "schedule")
+		c.SetParamValues(uuid.NewString(), "invalid-uuid")
+
+		err := handler.CancelSchedule()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		mockUsecase.AssertNotCalled(t, "CancelSchedule")
+	})
+
+	t.Run("Executions", func(t *testing.T) {
+		mockUsecase := new(wallet.MockWalletUsecase)
+		handler := NewWalletHandler(cfg, mockUsecase, log)
+
+		walletID, scheduleID := uuid.New(), uuid.New()
+		executions := []models.ScheduleExecution{
+			{ID: uuid.New(), ScheduleID: scheduleID, Status: models.ExecutionStatusFailed, Error: wallet.ErrInsufficientFunds.Error()},
+		}
+		mockUsecase.On("GetScheduleExecutions", mock.Anything, walletID, scheduleID).Return(executions, nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("uuid", "schedule")
+		c.SetParamValues(walletID.String(), scheduleID.String())
+
+		err := handler.ScheduleExecutions()(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"failed"`)
 		mockUsecase.AssertExpectations(t)
 	})
 }
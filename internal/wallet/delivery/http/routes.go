@@ -6,7 +6,23 @@ import (
 )
 
 func MapWalletRoutes(walletGroup *echo.Group, h wallet.Handlers) {
+	walletGroup.GET("/wallets", h.List())
 	walletGroup.GET("/wallets/:uuid", h.Display())
+	walletGroup.GET("/wallets/:uuid/transactions", h.Transactions())
+	walletGroup.GET("/wallets/:uuid/limits", h.Limits())
+	walletGroup.GET("/wallets/:uuid/schedules", h.Schedules())
+	walletGroup.POST("/wallets/:uuid/schedules", h.CreateSchedule())
+	walletGroup.DELETE("/wallets/:uuid/schedules/:schedule", h.CancelSchedule())
+	walletGroup.GET("/wallets/:uuid/schedules/:schedule/executions", h.ScheduleExecutions())
 	walletGroup.POST("/wallet", h.Operation())
 	walletGroup.POST("/new", h.CreateWallet())
 }
+
+// MapAdminRoutes операции над жизненным циклом и лимитами кошелька, доступные только администраторам
+func MapAdminRoutes(adminGroup *echo.Group, h wallet.Handlers) {
+	adminGroup.POST("/wallets/:uuid/freeze", h.Freeze())
+	adminGroup.POST("/wallets/:uuid/unfreeze", h.Unfreeze())
+	adminGroup.POST("/wallets/:uuid/close", h.Close())
+	adminGroup.PUT("/wallets/:uuid/limits", h.SetLimits())
+	adminGroup.GET("/ledger/check", h.LedgerCheck())
+}
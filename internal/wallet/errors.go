@@ -0,0 +1,79 @@
+package wallet
+
+import "errors"
+
+// Доменные ошибки кошелька. Слой доставки сопоставляет их с HTTP-статусами
+// и стабильными кодами ошибок, поэтому сравнивать их нужно через errors.Is.
+var (
+	// ErrWalletNotFound возвращается, когда кошелек с указанным ID не существует
+	ErrWalletNotFound = errors.New("wallet not found")
+	// ErrInsufficientFunds возвращается, когда списание увело бы баланс в минус
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrInvalidAmount возвращается для нулевых и отрицательных сумм операций
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrSameWallet возвращается при попытке перевода на тот же кошелек
+	ErrSameWallet = errors.New("source and destination wallets are the same")
+	// ErrUnsupportedCurrency возвращается для неизвестного кода валюты ISO 4217
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	// ErrCurrencyMismatch возвращается, когда валюта операции не совпадает с валютой кошелька
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrWalletFrozen возвращается при операциях над замороженным кошельком
+	ErrWalletFrozen = errors.New("wallet is frozen")
+	// ErrWalletClosed возвращается при операциях над закрытым кошельком
+	ErrWalletClosed = errors.New("wallet is closed")
+	// ErrInvalidStatusTransition возвращается, когда кошелек нельзя перевести
+	// из текущего статуса в запрошенный
+	ErrInvalidStatusTransition = errors.New("invalid wallet status transition")
+	// ErrWalletNotEmpty возвращается при попытке закрыть кошелек с ненулевым балансом
+	ErrWalletNotEmpty = errors.New("wallet balance is not zero")
+	// ErrInvalidLimit возвращается для отрицательных значений лимитов
+	ErrInvalidLimit = errors.New("invalid limit")
+	// ErrOperationLimitExceeded возвращается, когда сумма операции больше лимита на одну операцию
+	ErrOperationLimitExceeded = errors.New("operation amount exceeds the per-operation limit")
+	// ErrBalanceOverflow возвращается, когда пополнение переполнило бы int64 баланса
+	ErrBalanceOverflow = errors.New("operation would overflow the wallet balance")
+	// ErrBalanceLimitExceeded возвращается, когда пополнение подняло бы баланс выше максимального
+	ErrBalanceLimitExceeded = errors.New("operation would exceed the maximum wallet balance")
+	// ErrDailyWithdrawalLimitExceeded возвращается, когда списания за сутки превысили бы лимит
+	ErrDailyWithdrawalLimitExceeded = errors.New("daily withdrawal limit exceeded")
+	// ErrMonthlyWithdrawalLimitExceeded возвращается, когда списания за 30 дней превысили бы лимит
+	ErrMonthlyWithdrawalLimitExceeded = errors.New("monthly withdrawal limit exceeded")
+	// ErrHoldNotFound возвращается, когда холда с указанным ID нет у кошелька
+	ErrHoldNotFound = errors.New("hold not found")
+	// ErrHoldNotActive возвращается при списании или снятии уже списанного,
+	// снятого или истекшего холда
+	ErrHoldNotActive = errors.New("hold is not active")
+	// ErrCaptureExceedsHold возвращается, когда списание больше остатка холда
+	ErrCaptureExceedsHold = errors.New("capture amount exceeds the remaining hold amount")
+	// ErrTransactionNotFound возвращается, когда операции с указанным ID нет в журнале кошелька
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrNotReversible возвращается при попытке сторнировать операцию,
+	// которую нельзя отменить: перевод или само сторно
+	ErrNotReversible = errors.New("transaction cannot be reversed")
+	// ErrAlreadyReversed возвращается, когда операция уже сторнирована на полную сумму
+	ErrAlreadyReversed = errors.New("transaction is already fully reversed")
+	// ErrReversalExceedsOriginal возвращается, когда сторно вместе с предыдущими
+	// превысило бы сумму исходной операции
+	ErrReversalExceedsOriginal = errors.New("reversal amount exceeds the remaining original amount")
+	// ErrInvalidSchedule возвращается для неизвестной операции или периодичности расписания
+	// и для перевода без кошелька получателя
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	// ErrScheduleNotFound возвращается, когда расписания с указанным ID нет у кошелька
+	ErrScheduleNotFound = errors.New("schedule not found")
+	// ErrScheduleNotActive возвращается при отмене уже выполненного или отмененного расписания
+	ErrScheduleNotActive = errors.New("schedule is not active")
+	// ErrScheduleInPast возвращается, когда время первого запуска уже прошло
+	ErrScheduleInPast = errors.New("schedule start time is in the past")
+	// ErrWalletExists возвращается, когда кошелек с переданным клиентом ID
+	// уже создан с другими валютой, владельцем, названием или метаданными
+	ErrWalletExists = errors.New("wallet with this ID already exists with different attributes")
+	// ErrVersionMismatch возвращается, когда версия кошелька изменилась после того,
+	// как клиент ее прочитал (заголовок If-Match)
+	ErrVersionMismatch = errors.New("wallet version mismatch")
+	// ErrIdempotencyKeyReused возвращается, когда ключ идемпотентности уже
+	// использован для запроса с другими параметрами
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with different payload")
+	// ErrOperationInProgress возвращается, когда операция под тем же ключом
+	// идемпотентности еще не завершилась
+	ErrOperationInProgress = errors.New("operation with this idempotency key is in progress")
+)
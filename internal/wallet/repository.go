@@ -2,13 +2,36 @@ package wallet
 
 import (
 	"context"
+	"time"
 
+	"github.com/22Fariz22/wallet/internal/models"
 	"github.com/google/uuid"
 )
 
 type Repository interface {
-	Deposit(ctx context.Context, walletID uuid.UUID, amount int64) error
-	Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) error
-	Display(ctx context.Context, walletID uuid.UUID) (int64, error)
-	CreateWallet(ctx context.Context, walletID uuid.UUID) (uuid.UUID, error)
+	Deposit(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error)
+	Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error)
+	Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (*models.Transaction, error)
+	Reverse(ctx context.Context, walletID, transactionID uuid.UUID, amount int64) (*models.Transaction, error)
+	Display(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error)
+	CreateHold(ctx context.Context, walletID uuid.UUID, amount int64, expiresAt time.Time) (*models.Hold, error)
+	CaptureHold(ctx context.Context, walletID, holdID uuid.UUID, amount int64) (*models.Transaction, error)
+	ReleaseHold(ctx context.Context, walletID, holdID uuid.UUID) (*models.Hold, error)
+	ExpireHolds(ctx context.Context, limit int) ([]uuid.UUID, error)
+	CreateSchedule(ctx context.Context, s *models.Schedule) (*models.Schedule, error)
+	ListSchedules(ctx context.Context, walletID uuid.UUID) ([]models.Schedule, error)
+	CancelSchedule(ctx context.Context, walletID, scheduleID uuid.UUID) (*models.Schedule, error)
+	GetScheduleExecutions(ctx context.Context, walletID, scheduleID uuid.UUID, limit int) ([]models.ScheduleExecution, error)
+	ClaimDueSchedules(ctx context.Context, limit int) ([]models.ScheduledRun, error)
+	CompleteScheduleExecution(ctx context.Context, execution *models.ScheduleExecution) error
+	CreateWallet(ctx context.Context, w *models.Wallet) (*models.Wallet, error)
+	ListWallets(ctx context.Context, ownerID string) ([]models.Wallet, error)
+	UpdateStatus(ctx context.Context, walletID uuid.UUID, status string) (*models.Wallet, error)
+	GetTransactions(ctx context.Context, walletID uuid.UUID, filter models.TransactionFilter) ([]models.Transaction, error)
+	GetLimits(ctx context.Context, walletID uuid.UUID) (*models.WalletLimits, error)
+	SetLimits(ctx context.Context, limits *models.WalletLimits) (*models.WalletLimits, error)
+	CheckLedger(ctx context.Context) (*models.LedgerCheck, error)
+	ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
 }
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
+	"github.com/22Fariz22/wallet/internal/wallet"
+	redisdb "github.com/22Fariz22/wallet/pkg/db/redis"
+	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// cachedRepository оборачивает любой wallet.Repository и кэширует снимки кошельков в Redis:
+// чтение идет сначала в кэш (read-through), после успешной записи кэш обновляется (write-through).
+// Методы, которые кэш не затрагивают, делегируются внутреннему репозиторию как есть
+type cachedRepository struct {
+	wallet.Repository
+	cache  *walletCache
+	logger logger.Logger
+	// loads объединяет одновременные промахи по одному кошельку в один запрос к БД
+	loads singleflight.Group
+}
+
+// NewCachedRepository добавляет кэширование балансов в Redis к репозиторию inner.
+// TTL, jitter и префикс ключей берутся из cfg
+func NewCachedRepository(inner wallet.Repository, redisClient *redis.Client, cfg config.RedisConfig, logger logger.Logger) wallet.Repository {
+	return &cachedRepository{Repository: inner, cache: newWalletCache(redisClient, cfg, logger), logger: logger}
+}
+
+// FlushCache удаляет все снимки кошельков из Redis, например после его восстановления
+func FlushCache(ctx context.Context, redisClient *redis.Client, cfg config.RedisConfig, logger logger.Logger) error {
+	if err := newWalletCache(redisClient, cfg, logger).Flush(ctx); err != nil {
+		logger.Errorf("Failed to flush wallet cache: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *cachedRepository) Display(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
+	//  Пытаемся получить кошелек из Redis
+	cached, err := r.cache.Get(ctx, walletID)
+	if err == nil {
+		return cached, nil
+	}
+	if !errors.Is(err, redis.Nil) && !errors.Is(err, redisdb.ErrCircuitOpen) {
+		r.logger.Warnf("Failed to read Redis cache: walletID=%s, error=%v", walletID, err)
+	}
+
+	//  Если в Redis нет, идем в БД, но одним запросом на все одновременные промахи.
+	//  Загрузка общая, поэтому отмена запроса одного из ожидающих ее не прерывает
+	v, err, _ := r.loads.Do(walletID.String(), func() (interface{}, error) {
+		return r.load(context.WithoutCancel(ctx), walletID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//  Каждому вызывающему своя копия, снимок из singleflight общий
+	w := *v.(*models.Wallet)
+	return &w, nil
+}
+
+// load перечитывает кошелек из БД и кладет его в кэш. Если включена блокировка,
+// из БД читает только реплика, взявшая ее, остальные дожидаются свежего снимка в кэше
+func (r *cachedRepository) load(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
+	if r.cache.lockEnabled {
+		token, acquired, err := r.cache.Lock(ctx, walletID)
+		switch {
+		case errors.Is(err, redisdb.ErrCircuitOpen):
+			// Redis недоступен, блокировать нечем: читаем из БД
+		case err != nil:
+			r.logger.Warnf("Failed to acquire cache lock: walletID=%s, error=%v", walletID, err)
+		case acquired:
+			defer r.cache.Unlock(ctx, walletID, token)
+		default:
+			if w, ok := r.cache.WaitFor(ctx, walletID); ok {
+				return w, nil
+			}
+			// Владелец блокировки не успел: читаем сами, версия в кэше не даст записать старое
+		}
+	}
+
+	w, err := r.Repository.Display(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	//  Обновляем кэш: более новая версия в кэше не будет перезаписана
+	r.cache.Refresh(ctx, w)
+
+	return w, nil
+}
+
+func (r *cachedRepository) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
+	transaction, err := r.Repository.Deposit(ctx, walletID, amount)
+	r.afterWrite(ctx, err, walletID)
+	return transaction, err
+}
+
+func (r *cachedRepository) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
+	transaction, err := r.Repository.Withdraw(ctx, walletID, amount)
+	r.afterWrite(ctx, err, walletID)
+	return transaction, err
+}
+
+func (r *cachedRepository) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (*models.Transaction, error) {
+	transaction, err := r.Repository.Transfer(ctx, fromID, toID, amount)
+	r.afterWrite(ctx, err, fromID, toID)
+	return transaction, err
+}
+
+func (r *cachedRepository) Reverse(ctx context.Context, walletID, transactionID uuid.UUID, amount int64) (*models.Transaction, error) {
+	transaction, err := r.Repository.Reverse(ctx, walletID, transactionID, amount)
+	r.afterWrite(ctx, err, walletID)
+	return transaction, err
+}
+
+// Холды меняют зарезервированную сумму, а значит и доступный баланс в снимке
+
+func (r *cachedRepository) CreateHold(ctx context.Context, walletID uuid.UUID, amount int64, expiresAt time.Time) (*models.Hold, error) {
+	hold, err := r.Repository.CreateHold(ctx, walletID, amount, expiresAt)
+	r.afterWrite(ctx, err, walletID)
+	return hold, err
+}
+
+func (r *cachedRepository) CaptureHold(ctx context.Context, walletID, holdID uuid.UUID, amount int64) (*models.Transaction, error) {
+	transaction, err := r.Repository.CaptureHold(ctx, walletID, holdID, amount)
+	r.afterWrite(ctx, err, walletID)
+	return transaction, err
+}
+
+func (r *cachedRepository) ReleaseHold(ctx context.Context, walletID, holdID uuid.UUID) (*models.Hold, error) {
+	hold, err := r.Repository.ReleaseHold(ctx, walletID, holdID)
+	r.afterWrite(ctx, err, walletID)
+	return hold, err
+}
+
+func (r *cachedRepository) ExpireHolds(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	walletIDs, err := r.Repository.ExpireHolds(ctx, limit)
+	// Кошельки, обработанные до ошибки, уже изменены в БД
+	r.afterWrite(ctx, nil, walletIDs...)
+	return walletIDs, err
+}
+
+func (r *cachedRepository) CreateWallet(ctx context.Context, w *models.Wallet) (*models.Wallet, error) {
+	created, err := r.Repository.CreateWallet(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache.Refresh(context.WithoutCancel(ctx), created)
+	return created, nil
+}
+
+func (r *cachedRepository) UpdateStatus(ctx context.Context, walletID uuid.UUID, status string) (*models.Wallet, error) {
+	updated, err := r.Repository.UpdateStatus(ctx, walletID, status)
+	if err != nil {
+		if !isDomainError(err) {
+			r.cache.Invalidate(context.WithoutCancel(ctx), walletID)
+		}
+		return nil, err
+	}
+
+	// Статус входит в снимок, иначе кэш продолжит отдавать старый
+	r.cache.Refresh(context.WithoutCancel(ctx), updated)
+	return updated, nil
+}
+
+// afterWrite синхронизирует кэш с результатом записи в БД.
+// При успехе перечитывает кошельки из БД и кладет свежие снимки в кэш.
+// Если запись не прошла по бизнес-причине, баланс не менялся и кэш не трогаем;
+// при любой другой ошибке итог (например, коммита) неизвестен, поэтому ключи сбрасываем
+func (r *cachedRepository) afterWrite(ctx context.Context, err error, walletIDs ...uuid.UUID) {
+	// Операция уже выполнена или прервана: отмена запроса не должна оставить кэш несогласованным
+	ctx = context.WithoutCancel(ctx)
+
+	if err != nil {
+		if !isDomainError(err) {
+			r.cache.Invalidate(ctx, walletIDs...)
+		}
+		return
+	}
+
+	for _, walletID := range walletIDs {
+		w, err := r.Repository.Display(ctx, walletID)
+		if err != nil {
+			r.logger.Warnf("Failed to reload wallet for cache: walletID=%s, error=%v", walletID, err)
+			r.cache.Invalidate(ctx, walletID)
+			continue
+		}
+		r.cache.Refresh(ctx, w)
+	}
+}
+
+// isDomainError ошибки, при которых запись в БД гарантированно не произошла
+func isDomainError(err error) bool {
+	return errors.Is(err, wallet.ErrWalletNotFound) ||
+		errors.Is(err, wallet.ErrInsufficientFunds) ||
+		errors.Is(err, wallet.ErrCurrencyMismatch) ||
+		errors.Is(err, wallet.ErrWalletFrozen) ||
+		errors.Is(err, wallet.ErrWalletClosed) ||
+		errors.Is(err, wallet.ErrInvalidStatusTransition) ||
+		errors.Is(err, wallet.ErrWalletNotEmpty) ||
+		errors.Is(err, wallet.ErrOperationLimitExceeded) ||
+		errors.Is(err, wallet.ErrBalanceOverflow) ||
+		errors.Is(err, wallet.ErrBalanceLimitExceeded) ||
+		errors.Is(err, wallet.ErrDailyWithdrawalLimitExceeded) ||
+		errors.Is(err, wallet.ErrMonthlyWithdrawalLimitExceeded) ||
+		errors.Is(err, wallet.ErrHoldNotFound) ||
+		errors.Is(err, wallet.ErrHoldNotActive) ||
+		errors.Is(err, wallet.ErrCaptureExceedsHold) ||
+		errors.Is(err, wallet.ErrTransactionNotFound) ||
+		errors.Is(err, wallet.ErrNotReversible) ||
+		errors.Is(err, wallet.ErrAlreadyReversed) ||
+		errors.Is(err, wallet.ErrReversalExceedsOriginal) ||
+		errors.Is(err, wallet.ErrVersionMismatch)
+}
@@ -0,0 +1,570 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
+	"github.com/22Fariz22/wallet/internal/wallet"
+	redisdb "github.com/22Fariz22/wallet/pkg/db/redis"
+	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/go-redis/redismock/v9"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockInnerRepo репозиторий под кэшем. Методы, которые декоратор
+// просто делегирует, не переопределены и в этих тестах не вызываются
+type mockInnerRepo struct {
+	wallet.Repository
+	mock.Mock
+}
+
+func (m *mockInnerRepo) Display(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
+	args := m.Called(ctx, walletID)
+	w, _ := args.Get(0).(*models.Wallet)
+	return w, args.Error(1)
+}
+
+func (m *mockInnerRepo) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, walletID, amount)
+	t, _ := args.Get(0).(*models.Transaction)
+	return t, args.Error(1)
+}
+
+func (m *mockInnerRepo) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, walletID, amount)
+	t, _ := args.Get(0).(*models.Transaction)
+	return t, args.Error(1)
+}
+
+func (m *mockInnerRepo) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, fromID, toID, amount)
+	t, _ := args.Get(0).(*models.Transaction)
+	return t, args.Error(1)
+}
+
+func (m *mockInnerRepo) UpdateStatus(ctx context.Context, walletID uuid.UUID, status string) (*models.Wallet, error) {
+	args := m.Called(ctx, walletID, status)
+	w, _ := args.Get(0).(*models.Wallet)
+	return w, args.Error(1)
+}
+
+func (m *mockInnerRepo) CreateWallet(ctx context.Context, w *models.Wallet) (*models.Wallet, error) {
+	args := m.Called(ctx, w)
+	created, _ := args.Get(0).(*models.Wallet)
+	return created, args.Error(1)
+}
+
+func (m *mockInnerRepo) CaptureHold(ctx context.Context, walletID, holdID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, walletID, holdID, amount)
+	t, _ := args.Get(0).(*models.Transaction)
+	return t, args.Error(1)
+}
+
+func (m *mockInnerRepo) ExpireHolds(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	args := m.Called(ctx, limit)
+	walletIDs, _ := args.Get(0).([]uuid.UUID)
+	return walletIDs, args.Error(1)
+}
+
+// testCacheConfig конфиг кэша без jitter, чтобы TTL в ожиданиях redismock был детерминирован
+var testCacheConfig = config.RedisConfig{WalletAmountCasheTTL: 10 * time.Minute}
+
+// snapshot кошелек в том виде, в котором его возвращает внутренний репозиторий
+func snapshot(walletID uuid.UUID, amount int64) *models.Wallet {
+	return &models.Wallet{WalletID: walletID, Amount: amount, Currency: "RUB", Version: 1, Status: models.WalletStatusActive}
+}
+
+// walletJSON снимок кошелька в том виде, в котором он лежит в Redis
+func walletJSON(walletID uuid.UUID, amount int64) []byte {
+	data, _ := json.Marshal(snapshot(walletID, amount))
+	return data
+}
+
+// expectCacheSet ожидание версионированной записи снимка кошелька в Redis
+func expectCacheSet(redisMock redismock.ClientMock, walletID uuid.UUID, amount int64) *redismock.ExpectedCmd {
+	return redisMock.ExpectEvalSha(setIfNewerScript.Hash(), []string{fmt.Sprintf("wallet_balance:%s", walletID)},
+		string(walletJSON(walletID, amount)), int64(1), testCacheConfig.WalletAmountCasheTTL.Milliseconds())
+}
+
+func TestCachedRepo_Display(t *testing.T) {
+	mockRedis, redisMock := redismock.NewClientMock()
+	inner := &mockInnerRepo{}
+	repo := NewCachedRepository(inner, mockRedis, testCacheConfig, logger.NewMockLogger())
+
+	t.Run("Success from Redis", func(t *testing.T) {
+		walletID := uuid.New()
+
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).SetVal(string(walletJSON(walletID, 500)))
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Equal(t, "RUB", w.Currency)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+		inner.AssertNotCalled(t, "Display", mock.Anything, walletID)
+	})
+
+	t.Run("Success from DB", func(t *testing.T) {
+		walletID := uuid.New()
+
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).RedisNil()
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 500), nil).Once()
+		expectCacheSet(redisMock, walletID, 500).SetVal(int64(1))
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+		inner.AssertExpectations(t)
+	})
+
+	t.Run("Redis Unavailable", func(t *testing.T) {
+		walletID := uuid.New()
+
+		// ошибка Redis не ломает чтение, запрос уходит в БД
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).SetErr(errors.New("redis error"))
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 500), nil).Once()
+		expectCacheSet(redisMock, walletID, 500).SetVal(int64(1))
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("Circuit Open", func(t *testing.T) {
+		walletID := uuid.New()
+
+		// Пока breaker разомкнут, команды сразу отклоняются: читаем из БД
+		// и не пытаемся ни обновить, ни сбросить кэш
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).SetErr(redisdb.ErrCircuitOpen)
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 500), nil).Once()
+		expectCacheSet(redisMock, walletID, 500).SetErr(redisdb.ErrCircuitOpen)
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("Snapshot Without Status", func(t *testing.T) {
+		walletID := uuid.New()
+
+		// Снимок из кэша, записанный до появления статуса, перечитывается из БД
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).
+			SetVal(fmt.Sprintf(`{"wallet_id":"%s","amount":500,"currency":"RUB","version":1}`, walletID))
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 500), nil).Once()
+		expectCacheSet(redisMock, walletID, 500).SetVal(int64(1))
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.WalletStatusActive, w.Status)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("Wallet Not Found", func(t *testing.T) {
+		walletID := uuid.New()
+
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).RedisNil()
+		inner.On("Display", mock.Anything, walletID).Return(nil, wallet.ErrWalletNotFound).Once()
+
+		_, err := repo.Display(context.Background(), walletID)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+}
+
+func TestCachedRepo_DisplayStampede(t *testing.T) {
+	t.Run("Concurrent Misses Share One Load", func(t *testing.T) {
+		mockRedis, redisMock := redismock.NewClientMock()
+		inner := &mockInnerRepo{}
+		repo := NewCachedRepository(inner, mockRedis, testCacheConfig, logger.NewMockLogger())
+		walletID := uuid.New()
+		const callers = 10
+
+		release := make(chan time.Time)
+		for i := 0; i < callers; i++ {
+			redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).RedisNil()
+		}
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 500), nil).WaitUntil(release)
+		expectCacheSet(redisMock, walletID, 500).SetVal(int64(1))
+
+		var started, done sync.WaitGroup
+		results := make([]*models.Wallet, callers)
+		for i := 0; i < callers; i++ {
+			started.Add(1)
+			done.Add(1)
+			go func(i int) {
+				defer done.Done()
+				started.Done()
+				w, err := repo.Display(context.Background(), walletID)
+				assert.NoError(t, err)
+				results[i] = w
+			}(i)
+		}
+
+		// Даем всем вызовам дойти до общей загрузки, прежде чем БД ответит
+		started.Wait()
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		done.Wait()
+
+		inner.AssertNumberOfCalls(t, "Display", 1)
+		for _, w := range results {
+			assert.Equal(t, int64(500), w.Amount)
+		}
+		// У каждого вызывающего своя копия снимка
+		assert.NotSame(t, results[0], results[1])
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	lockCfg := testCacheConfig
+	lockCfg.WalletCacheLockEnabled = true
+	lockCfg.WalletCacheLockTTL = 3 * time.Second
+	lockCfg.WalletCacheLockWait = time.Millisecond
+
+	t.Run("Lock Acquired", func(t *testing.T) {
+		mockRedis, redisMock := redismock.NewClientMock()
+		inner := &mockInnerRepo{}
+		repo := NewCachedRepository(inner, mockRedis, lockCfg, logger.NewMockLogger())
+		walletID := uuid.New()
+		lockKey := fmt.Sprintf("wallet_balance_lock:%s", walletID)
+
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).RedisNil()
+		redisMock.Regexp().ExpectSetNX(lockKey, ".+", lockCfg.WalletCacheLockTTL).SetVal(true)
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 500), nil).Once()
+		expectCacheSet(redisMock, walletID, 500).SetVal(int64(1))
+		redisMock.Regexp().ExpectEvalSha(releaseLockScript.Hash(), []string{lockKey}, ".+").SetVal(int64(1))
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+		inner.AssertExpectations(t)
+	})
+
+	t.Run("Lock Held By Another Replica", func(t *testing.T) {
+		mockRedis, redisMock := redismock.NewClientMock()
+		inner := &mockInnerRepo{}
+		repo := NewCachedRepository(inner, mockRedis, lockCfg, logger.NewMockLogger())
+		walletID := uuid.New()
+
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).RedisNil()
+		redisMock.Regexp().ExpectSetNX(fmt.Sprintf("wallet_balance_lock:%s", walletID), ".+", lockCfg.WalletCacheLockTTL).SetVal(false)
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).SetVal(string(walletJSON(walletID, 500)))
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+		inner.AssertNotCalled(t, "Display", mock.Anything, walletID)
+	})
+
+	t.Run("Lock Wait Timeout Falls Back To DB", func(t *testing.T) {
+		mockRedis, redisMock := redismock.NewClientMock()
+		inner := &mockInnerRepo{}
+		repo := NewCachedRepository(inner, mockRedis, lockCfg, logger.NewMockLogger())
+		walletID := uuid.New()
+
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).RedisNil()
+		redisMock.Regexp().ExpectSetNX(fmt.Sprintf("wallet_balance_lock:%s", walletID), ".+", lockCfg.WalletCacheLockTTL).SetVal(false)
+		redisMock.ExpectGet(fmt.Sprintf("wallet_balance:%s", walletID)).RedisNil()
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 500), nil).Once()
+		expectCacheSet(redisMock, walletID, 500).SetVal(int64(1))
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+		inner.AssertExpectations(t)
+	})
+}
+
+func TestCachedRepo_UpdateStatus(t *testing.T) {
+	mockRedis, redisMock := redismock.NewClientMock()
+	inner := &mockInnerRepo{}
+	repo := NewCachedRepository(inner, mockRedis, testCacheConfig, logger.NewMockLogger())
+
+	t.Run("Success Refreshes Cache", func(t *testing.T) {
+		walletID := uuid.New()
+		frozen := snapshot(walletID, 100)
+		frozen.Status = models.WalletStatusFrozen
+		data, _ := json.Marshal(frozen)
+
+		inner.On("UpdateStatus", mock.Anything, walletID, models.WalletStatusFrozen).Return(frozen, nil).Once()
+		redisMock.ExpectEvalSha(setIfNewerScript.Hash(), []string{fmt.Sprintf("wallet_balance:%s", walletID)},
+			string(data), int64(1), testCacheConfig.WalletAmountCasheTTL.Milliseconds()).SetVal(int64(1))
+
+		w, err := repo.UpdateStatus(context.Background(), walletID, models.WalletStatusFrozen)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.WalletStatusFrozen, w.Status)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejected Transition Keeps Cache", func(t *testing.T) {
+		walletID := uuid.New()
+
+		inner.On("UpdateStatus", mock.Anything, walletID, models.WalletStatusClosed).Return(nil, wallet.ErrWalletNotEmpty).Once()
+
+		_, err := repo.UpdateStatus(context.Background(), walletID, models.WalletStatusClosed)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotEmpty)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+}
+
+func TestCachedRepo_Deposit(t *testing.T) {
+	mockRedis, redisMock := redismock.NewClientMock()
+	inner := &mockInnerRepo{}
+	repo := NewCachedRepository(inner, mockRedis, testCacheConfig, logger.NewMockLogger())
+
+	t.Run("Success", func(t *testing.T) {
+		walletID := uuid.New()
+		transaction := &models.Transaction{WalletID: walletID, Type: models.TransactionTypeDeposit, Amount: 100, BalanceAfter: 200}
+
+		inner.On("Deposit", mock.Anything, walletID, int64(100)).Return(transaction, nil).Once()
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 200), nil).Once()
+		expectCacheSet(redisMock, walletID, 200).SetVal(int64(1))
+
+		result, err := repo.Deposit(context.Background(), walletID, 100)
+
+		assert.NoError(t, err)
+		assert.Equal(t, transaction, result)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+		inner.AssertExpectations(t)
+	})
+
+	t.Run("Cache Update Failure", func(t *testing.T) {
+		walletID := uuid.New()
+		transaction := &models.Transaction{WalletID: walletID, Type: models.TransactionTypeDeposit, Amount: 100, BalanceAfter: 200}
+
+		inner.On("Deposit", mock.Anything, walletID, int64(100)).Return(transaction, nil).Once()
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 200), nil).Once()
+		expectCacheSet(redisMock, walletID, 200).SetErr(errors.New("redis error"))
+		redisMock.ExpectDel(fmt.Sprintf("wallet_balance:%s", walletID)).SetVal(1)
+
+		// операция уже закоммичена, ошибка Redis на результат не влияет
+		_, err := repo.Deposit(context.Background(), walletID, 100)
+
+		assert.NoError(t, err)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown Outcome Invalidates Cache", func(t *testing.T) {
+		walletID := uuid.New()
+
+		inner.On("Deposit", mock.Anything, walletID, int64(100)).Return(nil, errors.New("failed to commit transaction")).Once()
+		redisMock.ExpectDel(fmt.Sprintf("wallet_balance:%s", walletID)).SetVal(1)
+
+		_, err := repo.Deposit(context.Background(), walletID, 100)
+
+		assert.Error(t, err)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+}
+
+func TestCachedRepo_Withdraw(t *testing.T) {
+	mockRedis, redisMock := redismock.NewClientMock()
+	inner := &mockInnerRepo{}
+	repo := NewCachedRepository(inner, mockRedis, testCacheConfig, logger.NewMockLogger())
+
+	t.Run("Insufficient Funds Keeps Cache", func(t *testing.T) {
+		walletID := uuid.New()
+
+		inner.On("Withdraw", mock.Anything, walletID, int64(100)).Return(nil, wallet.ErrInsufficientFunds).Once()
+
+		_, err := repo.Withdraw(context.Background(), walletID, 100)
+
+		assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+}
+
+func TestCachedRepo_Transfer(t *testing.T) {
+	mockRedis, redisMock := redismock.NewClientMock()
+	inner := &mockInnerRepo{}
+	repo := NewCachedRepository(inner, mockRedis, testCacheConfig, logger.NewMockLogger())
+
+	t.Run("Success", func(t *testing.T) {
+		fromID, toID := uuid.New(), uuid.New()
+		transaction := &models.Transaction{WalletID: fromID, Type: models.TransactionTypeTransferOut, Amount: 40, BalanceAfter: 60}
+
+		inner.On("Transfer", mock.Anything, fromID, toID, int64(40)).Return(transaction, nil).Once()
+		inner.On("Display", mock.Anything, fromID).Return(snapshot(fromID, 60), nil).Once()
+		inner.On("Display", mock.Anything, toID).Return(snapshot(toID, 50), nil).Once()
+		expectCacheSet(redisMock, fromID, 60).SetVal(int64(1))
+		expectCacheSet(redisMock, toID, 50).SetVal(int64(1))
+
+		result, err := repo.Transfer(context.Background(), fromID, toID, 40)
+
+		assert.NoError(t, err)
+		assert.Equal(t, transaction, result)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+		inner.AssertExpectations(t)
+	})
+
+	t.Run("Unknown Outcome Invalidates Both", func(t *testing.T) {
+		fromID, toID := uuid.New(), uuid.New()
+
+		inner.On("Transfer", mock.Anything, fromID, toID, int64(40)).Return(nil, errors.New("connection reset")).Once()
+		redisMock.ExpectDel(fmt.Sprintf("wallet_balance:%s", fromID)).SetVal(1)
+		redisMock.ExpectDel(fmt.Sprintf("wallet_balance:%s", toID)).SetVal(1)
+
+		_, err := repo.Transfer(context.Background(), fromID, toID, 40)
+
+		assert.Error(t, err)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+}
+
+func TestCachedRepo_Holds(t *testing.T) {
+	mockRedis, redisMock := redismock.NewClientMock()
+	inner := &mockInnerRepo{}
+	repo := NewCachedRepository(inner, mockRedis, testCacheConfig, logger.NewMockLogger())
+
+	t.Run("Hold Not Active Keeps Cache", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		inner.On("CaptureHold", mock.Anything, walletID, holdID, int64(50)).Return(nil, wallet.ErrHoldNotActive).Once()
+
+		_, err := repo.CaptureHold(context.Background(), walletID, holdID, 50)
+
+		assert.ErrorIs(t, err, wallet.ErrHoldNotActive)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("Expire Refreshes Processed Wallets", func(t *testing.T) {
+		walletID := uuid.New()
+
+		// Первый кошелек обработан до ошибки, его снимок все равно обновляется
+		inner.On("ExpireHolds", mock.Anything, 100).Return([]uuid.UUID{walletID}, errors.New("connection reset")).Once()
+		inner.On("Display", mock.Anything, walletID).Return(snapshot(walletID, 200), nil).Once()
+		expectCacheSet(redisMock, walletID, 200).SetVal(int64(1))
+
+		walletIDs, err := repo.ExpireHolds(context.Background(), 100)
+
+		assert.Error(t, err)
+		assert.Equal(t, []uuid.UUID{walletID}, walletIDs)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+		inner.AssertExpectations(t)
+	})
+}
+
+func TestCachedRepo_CreateWallet(t *testing.T) {
+	mockRedis, redisMock := redismock.NewClientMock()
+	inner := &mockInnerRepo{}
+	repo := NewCachedRepository(inner, mockRedis, testCacheConfig, logger.NewMockLogger())
+
+	t.Run("Success", func(t *testing.T) {
+		walletID := uuid.New()
+
+		inner.On("CreateWallet", mock.Anything, &models.Wallet{WalletID: walletID, Currency: "RUB"}).Return(snapshot(walletID, 0), nil).Once()
+		expectCacheSet(redisMock, walletID, 0).SetVal(int64(1))
+
+		created, err := repo.CreateWallet(context.Background(), &models.Wallet{WalletID: walletID, Currency: "RUB"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, walletID, created.WalletID)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("Redis Failure", func(t *testing.T) {
+		walletID := uuid.New()
+
+		inner.On("CreateWallet", mock.Anything, &models.Wallet{WalletID: walletID, Currency: "RUB"}).Return(snapshot(walletID, 0), nil).Once()
+		expectCacheSet(redisMock, walletID, 0).SetErr(errors.New("redis error"))
+		redisMock.ExpectDel(fmt.Sprintf("wallet_balance:%s", walletID)).SetVal(1)
+
+		created, err := repo.CreateWallet(context.Background(), &models.Wallet{WalletID: walletID, Currency: "RUB"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, walletID, created.WalletID)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("DB Failure", func(t *testing.T) {
+		walletID := uuid.New()
+
+		inner.On("CreateWallet", mock.Anything, &models.Wallet{WalletID: walletID, Currency: "RUB"}).Return(nil, errors.New("db error")).Once()
+
+		created, err := repo.CreateWallet(context.Background(), &models.Wallet{WalletID: walletID, Currency: "RUB"})
+
+		assert.Error(t, err)
+		assert.Nil(t, created)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletCache_Config(t *testing.T) {
+	t.Run("Key Prefix", func(t *testing.T) {
+		mockRedis, redisMock := redismock.NewClientMock()
+		cfg := config.RedisConfig{WalletAmountCasheTTL: time.Hour, WalletCacheKeyPrefix: "staging:"}
+		repo := NewCachedRepository(&mockInnerRepo{}, mockRedis, cfg, logger.NewMockLogger())
+		walletID := uuid.New()
+
+		redisMock.ExpectGet(fmt.Sprintf("staging:wallet_balance:%s", walletID)).SetVal(string(walletJSON(walletID, 500)))
+
+		w, err := repo.Display(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("TTL Jitter", func(t *testing.T) {
+		cache := newWalletCache(nil, config.RedisConfig{WalletAmountCasheTTL: time.Hour, WalletCacheTTLJitter: time.Minute}, logger.NewMockLogger())
+
+		for i := 0; i < 100; i++ {
+			ttl := cache.expiration()
+			assert.GreaterOrEqual(t, ttl, time.Hour)
+			assert.Less(t, ttl, time.Hour+time.Minute)
+		}
+	})
+
+	t.Run("Default TTL", func(t *testing.T) {
+		cache := newWalletCache(nil, config.RedisConfig{}, logger.NewMockLogger())
+
+		assert.Equal(t, defaultWalletCacheTTL, cache.expiration())
+	})
+
+	t.Run("Cache Disabled", func(t *testing.T) {
+		cfg := &config.Config{Redis: config.RedisConfig{WalletCacheEnabled: false}}
+
+		repo := NewWalletRepository(cfg, nil, nil, logger.NewMockLogger())
+
+		assert.IsType(t, &walletRepo{}, repo)
+	})
+}
+
+func TestFlushCache(t *testing.T) {
+	mockRedis, redisMock := redismock.NewClientMock()
+	cfg := config.RedisConfig{WalletAmountCasheTTL: time.Hour, WalletCacheKeyPrefix: "staging:"}
+	keys := []string{"staging:wallet_balance:" + uuid.NewString(), "staging:wallet_balance:" + uuid.NewString()}
+
+	redisMock.ExpectScan(0, "staging:wallet_balance:*", flushBatchSize).SetVal(keys, 0)
+	redisMock.ExpectUnlink(keys...).SetVal(2)
+
+	err := FlushCache(context.Background(), mockRedis, cfg, logger.NewMockLogger())
+
+	assert.NoError(t, err)
+	assert.Nil(t, redisMock.ExpectationsWereMet())
+}
@@ -2,10 +2,14 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"strconv"
+	"math"
 	"time"
 
+	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
 	"github.com/22Fariz22/wallet/internal/wallet"
 	"github.com/22Fariz22/wallet/pkg/logger"
 	"github.com/google/uuid"
@@ -13,139 +17,1427 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// walletColumns колонки снимка кошелька, общие для SELECT и RETURNING
+const walletColumns = "wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at"
+
+// transactionColumns колонки записи журнала, общие для выборок
+const transactionColumns = "id, wallet_id, type, amount, balance_after, counterparty_id, reversal_of, created_at"
+
+// scheduleColumns и executionColumns колонки расписания и записи журнала его запусков
+const (
+	scheduleColumns  = "id, wallet_id, operation_type, to_wallet_id, amount, recurrence, start_at, next_run_at, iteration, status, created_at"
+	executionColumns = "id, schedule_id, run_at, status, transaction_id, error, started_at, finished_at"
+)
+
+// holdColumns колонки холда, общие для SELECT и RETURNING
+const holdColumns = "id, wallet_id, amount, captured, status, expires_at, created_at"
+
+// ledgerCheckLimit сколько расходящихся проводок и кошельков возвращает сверка книги
+const ledgerCheckLimit = 100
+
 type walletRepo struct {
-	db          *sqlx.DB
-	logger      logger.Logger
-	redisClient *redis.Client
+	db *sqlx.DB
+	// defaultLimits лимиты для кошельков, у которых свои не заданы
+	defaultLimits models.WalletLimits
+	// fundingAccount и payoutAccount системные счета главной книги для пополнений и списаний
+	fundingAccount string
+	payoutAccount  string
+	// idempotencyTimeout возраст, после которого незавершенный ключ идемпотентности можно перехватить
+	idempotencyTimeout time.Duration
+	logger             logger.Logger
 }
 
-func NewWalletRepository(db *sqlx.DB, logger logger.Logger, redisClient *redis.Client) wallet.Repository {
-	return &walletRepo{db: db, logger: logger, redisClient: redisClient}
-}
+// NewWalletRepository репозиторий кошельков поверх Postgres. Если кэш включен
+// в конфиге, он оборачивается кэшем балансов в Redis
+func NewWalletRepository(cfg *config.Config, db *sqlx.DB, redisClient *redis.Client, logger logger.Logger) wallet.Repository {
+	repo := NewPgRepository(db, cfg.Wallet, logger)
+	if !cfg.Redis.WalletCacheEnabled {
+		logger.Info("Wallet balance cache is disabled")
+		return repo
+	}
 
-func (r *walletRepo) Display(ctx context.Context, walletID uuid.UUID) (int64, error) {
-	r.logger.Info("Display repo called")
-	cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
+	return NewCachedRepository(repo, redisClient, cfg.Redis, logger)
+}
 
-	//  Пытаемся получить баланс из Redis
-	balanceStr, err := r.redisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		r.logger.Error("error:", err)
-		balance, _ := strconv.ParseInt(balanceStr, 10, 64)
-		return balance, nil
+// NewPgRepository репозиторий кошельков поверх Postgres, без кэширования.
+// Лимиты по умолчанию берутся из cfg
+func NewPgRepository(db *sqlx.DB, cfg config.WalletConfig, logger logger.Logger) wallet.Repository {
+	return &walletRepo{
+		db: db,
+		defaultLimits: models.WalletLimits{
+			MaxOperationAmount:     &cfg.MaxOperationAmount,
+			MaxBalance:             &cfg.MaxBalance,
+			DailyWithdrawalLimit:   &cfg.DailyWithdrawalLimit,
+			MonthlyWithdrawalLimit: &cfg.MonthlyWithdrawalLimit,
+		},
+		fundingAccount:     cfg.FundingAccount,
+		payoutAccount:      cfg.PayoutAccount,
+		idempotencyTimeout: cfg.IdempotencyInProgressTimeout,
+		logger:             logger,
 	}
+}
+
+func (r *walletRepo) Display(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
+	r.logger.Info("Display repo called")
 
-	//  Если в Redis нет, идем в БД
-	var balance int64
-	err = r.db.GetContext(ctx, &balance, "SELECT amount FROM wallets WHERE wallet_id = $1", walletID)
+	w := &models.Wallet{}
+	err := r.db.GetContext(ctx, w, "SELECT "+walletColumns+" FROM wallets WHERE wallet_id = $1", walletID)
 	if err != nil {
 		r.logger.Error("error:", err)
-		return 0, err
+		return nil, mapNotFound(err)
 	}
 
-	//  Обновляем кэш в Redis
-	r.redisClient.Set(ctx, cacheKey, balance, 10*time.Minute)
-
-	return balance, nil
+	return w, nil
 }
 
-func (r *walletRepo) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) error {
+func (r *walletRepo) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
 	r.logger.Info("Display repo called")
 	r.logger.Infof("Deposit started: walletID=%s, amount=%d", walletID, amount)
 
-	var newBalance int64
+	updated := &models.Wallet{}
 
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		r.logger.Errorf("Failed to begin transaction: walletID=%s, error=%v", walletID, err)
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
+	// Блокируем строку кошелька: лимиты проверяются по балансу, который не изменится до коммита
+	current, err := r.lockWallet(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to lock wallet: walletID=%s, error=%v", walletID, err)
+		return nil, mapNotFound(err)
+	}
+
+	if err := statusError(current.Status); err != nil {
+		r.logger.Warnf("Deposit rejected: wallet %s is %s", walletID, current.Status)
+		return nil, err
+	}
+
+	limits, err := r.loadLimits(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to load limits: walletID=%s, error=%v", walletID, err)
+		return nil, err
+	}
+	if err := checkCredit(limits, current.Amount, amount); err != nil {
+		r.logger.Warnf("Deposit rejected: wallet %s, amount: %d, error: %v", walletID, amount, err)
+		return nil, err
+	}
+
 	// Обновляем баланс в БД и сразу получаем новое значение
-	err = tx.GetContext(ctx, &newBalance,
-		"UPDATE wallets SET amount = amount + $1 WHERE wallet_id = $2 RETURNING amount",
-		amount, walletID)
+	guard, args := versionGuard(ctx, amount, walletID)
+	err = tx.GetContext(ctx, updated,
+		"UPDATE wallets SET amount = amount + $1, version = version + 1, updated_at = now() WHERE wallet_id = $2"+guard+" RETURNING "+walletColumns,
+		args...)
 	if err != nil {
 		r.logger.Errorf("Failed to update balance: walletID=%s, amount=%d, error=%v", walletID, amount, err)
-		return fmt.Errorf("failed to update balance: %w", err)
+		return nil, fmt.Errorf("failed to update balance: %w", mapVersionMismatch(err))
 	}
 
-	// Обновляем кэш в Redis
-	cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
-	if err := r.redisClient.Set(ctx, cacheKey, newBalance, 10*time.Minute).Err(); err != nil {
-		r.logger.Warnf("Failed to update Redis cache: walletID=%s, error=%v", walletID, err)
-		// Не прерываем выполнение, так как основная операция уже выполнена
+	// Записываем операцию в журнал в той же транзакции
+	transaction := &models.Transaction{
+		WalletID:     walletID,
+		Type:         models.TransactionTypeDeposit,
+		Amount:       amount,
+		BalanceAfter: updated.Amount,
+	}
+	if err := r.insertTransaction(ctx, tx, transaction); err != nil {
+		r.logger.Errorf("Failed to record transaction: walletID=%s, amount=%d, error=%v", walletID, amount, err)
+		return nil, fmt.Errorf("failed to record transaction: %w", err)
+	}
+
+	// Деньги приходят в кошелек со счета funding
+	if err := r.postEntry(ctx, tx, models.TransactionTypeDeposit, transaction.ID,
+		systemLeg(r.fundingAccount, -amount), walletLeg(walletID, amount)); err != nil {
+		r.logger.Errorf("Failed to post ledger entry: walletID=%s, amount=%d, error=%v", walletID, amount, err)
+		return nil, fmt.Errorf("failed to post ledger entry: %w", err)
 	}
 
 	// Фиксируем транзакцию
 	if err := tx.Commit(); err != nil {
 		r.logger.Errorf("Failed to commit transaction: walletID=%s, error=%v", walletID, err)
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	r.logger.Infof("Deposit success: wallet %s, new balance: %d", walletID, newBalance)
-	return nil
+	r.logger.Infof("Deposit success: wallet %s, new balance: %d", walletID, updated.Amount)
+	return transaction, nil
 }
 
-func (r *walletRepo) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) error {
-	var newBalance int64
+func (r *walletRepo) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
+	updated := &models.Wallet{}
 
 	// Начинаем транзакцию
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		r.logger.Errorf("Failed to begin transaction: %v", err)
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
-	// Обновляем баланс, но не даем уйти в минус
-	err = tx.GetContext(ctx, &newBalance,
-		"UPDATE wallets SET amount = amount - $1 WHERE wallet_id = $2 RETURNING amount",
-		amount, walletID)
+	// Блокируем строку кошелька, чтобы проверка и списание были атомарными
+	current, err := r.lockWallet(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to lock wallet: %v", err)
+		return nil, mapNotFound(err)
+	}
+
+	if err := statusError(current.Status); err != nil {
+		r.logger.Warnf("Withdraw rejected: wallet %s is %s", walletID, current.Status)
+		return nil, err
+	}
+
+	// Не даем балансу уйти в минус: зарезервированное холдами списывать нельзя
+	if current.Available() < amount {
+		r.logger.Warnf("Insufficient funds: wallet %s, available: %d, amount: %d", walletID, current.Available(), amount)
+		return nil, wallet.ErrInsufficientFunds
+	}
+
+	limits, err := r.loadLimits(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to load limits: %v", err)
+		return nil, err
+	}
+	if err := r.checkDebit(ctx, tx, current, limits, amount); err != nil {
+		r.logger.Warnf("Withdraw rejected: wallet %s, amount: %d, error: %v", walletID, amount, err)
+		return nil, err
+	}
+
+	guard, args := versionGuard(ctx, amount, walletID)
+	err = tx.GetContext(ctx, updated,
+		"UPDATE wallets SET amount = amount - $1, version = version + 1, updated_at = now() WHERE wallet_id = $2"+guard+" RETURNING "+walletColumns,
+		args...)
 	if err != nil {
 		r.logger.Errorf("Failed to update balance: %v", err)
 
-		return err
+		return nil, mapVersionMismatch(err)
+	}
+
+	// Записываем операцию в журнал в той же транзакции
+	transaction := &models.Transaction{
+		WalletID:     walletID,
+		Type:         models.TransactionTypeWithdraw,
+		Amount:       amount,
+		BalanceAfter: updated.Amount,
+	}
+	if err := r.insertTransaction(ctx, tx, transaction); err != nil {
+		r.logger.Errorf("Failed to record transaction: %v", err)
+		return nil, err
 	}
 
-	// Обновляем кэш в Redis
-	cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
-	if err := r.redisClient.Set(ctx, cacheKey, newBalance, 10*time.Minute).Err(); err != nil {
-		r.logger.Warnf("Failed to update Redis cache: %v", err)
-		// Не прерываем выполнение, так как основная операция уже выполнена
+	// Деньги уходят из кошелька на счет payout
+	if err := r.postEntry(ctx, tx, models.TransactionTypeWithdraw, transaction.ID,
+		walletLeg(walletID, -amount), systemLeg(r.payoutAccount, amount)); err != nil {
+		r.logger.Errorf("Failed to post ledger entry: %v", err)
+		return nil, err
 	}
 
 	// Фиксируем транзакцию
 	if err := tx.Commit(); err != nil {
 		r.logger.Errorf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	r.logger.Infof("Withdraw success: wallet %s, new balance: %d", walletID, updated.Amount)
+	return transaction, nil
+}
+
+// Transfer переводит средства между кошельками в одной транзакции БД.
+// Возвращает запись журнала о списании с кошелька-отправителя
+func (r *walletRepo) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (*models.Transaction, error) {
+	r.logger.Infof("Transfer started: from=%s, to=%s, amount=%d", fromID, toID, amount)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Блокируем оба кошелька в порядке wallet_id, чтобы встречные переводы не ловили дедлок
+	var wallets []models.Wallet
+	err = tx.SelectContext(ctx, &wallets,
+		"SELECT wallet_id, amount, held, currency, status FROM wallets WHERE wallet_id IN ($1, $2) ORDER BY wallet_id FOR UPDATE",
+		fromID, toID)
+	if err != nil {
+		r.logger.Errorf("Failed to lock wallets: from=%s, to=%s, error=%v", fromID, toID, err)
+		return nil, err
+	}
+	if len(wallets) != 2 {
+		return nil, wallet.ErrWalletNotFound
+	}
+
+	// Оба кошелька должны быть активны
+	for _, w := range wallets {
+		if err := statusError(w.Status); err != nil {
+			r.logger.Warnf("Transfer rejected: wallet %s is %s", w.WalletID, w.Status)
+			return nil, err
+		}
+	}
+
+	// Переводы возможны только между кошельками в одной валюте
+	if wallets[0].Currency != wallets[1].Currency {
+		r.logger.Warnf("Currency mismatch: from=%s, to=%s", fromID, toID)
+		return nil, wallet.ErrCurrencyMismatch
+	}
+
+	from := &wallets[0]
+	if from.WalletID != fromID {
+		from = &wallets[1]
+	}
+	if from.Available() < amount {
+		r.logger.Warnf("Insufficient funds: wallet %s, available: %d, amount: %d", fromID, from.Available(), amount)
+		return nil, wallet.ErrInsufficientFunds
+	}
+
+	// Для отправителя перевод это списание, для получателя пополнение
+	fromLimits, err := r.loadLimits(ctx, tx, fromID)
+	if err != nil {
+		r.logger.Errorf("Failed to load limits: wallet %s, error=%v", fromID, err)
+		return nil, err
+	}
+	if err := r.checkDebit(ctx, tx, from, fromLimits, amount); err != nil {
+		r.logger.Warnf("Transfer rejected: wallet %s, amount: %d, error: %v", fromID, amount, err)
+		return nil, err
+	}
+	toLimits, err := r.loadLimits(ctx, tx, toID)
+	if err != nil {
+		r.logger.Errorf("Failed to load limits: wallet %s, error=%v", toID, err)
+		return nil, err
+	}
+	for _, w := range wallets {
+		if w.WalletID != toID {
+			continue
+		}
+		if err := checkCredit(toLimits, w.Amount, amount); err != nil {
+			r.logger.Warnf("Transfer rejected: wallet %s, amount: %d, error: %v", toID, amount, err)
+			return nil, err
+		}
+	}
+
+	// Ожидаемая клиентом версия относится к кошельку-отправителю
+	from, to := &models.Wallet{}, &models.Wallet{}
+	guard, args := versionGuard(ctx, amount, fromID)
+	err = tx.GetContext(ctx, from,
+		"UPDATE wallets SET amount = amount - $1, version = version + 1, updated_at = now() WHERE wallet_id = $2"+guard+" RETURNING "+walletColumns,
+		args...)
+	if err != nil {
+		r.logger.Errorf("Failed to debit wallet: %s, error=%v", fromID, err)
+		return nil, mapVersionMismatch(err)
+	}
+	err = tx.GetContext(ctx, to,
+		"UPDATE wallets SET amount = amount + $1, version = version + 1, updated_at = now() WHERE wallet_id = $2 RETURNING "+walletColumns,
+		amount, toID)
+	if err != nil {
+		r.logger.Errorf("Failed to credit wallet: %s, error=%v", toID, err)
+		return nil, err
+	}
+
+	// Обе ноги перевода пишем в журнал со ссылкой на встречный кошелек
+	outgoing := &models.Transaction{
+		WalletID:       fromID,
+		Type:           models.TransactionTypeTransferOut,
+		Amount:         amount,
+		BalanceAfter:   from.Amount,
+		CounterpartyID: &toID,
+	}
+	incoming := &models.Transaction{
+		WalletID:       toID,
+		Type:           models.TransactionTypeTransferIn,
+		Amount:         amount,
+		BalanceAfter:   to.Amount,
+		CounterpartyID: &fromID,
+	}
+	for _, transaction := range []*models.Transaction{outgoing, incoming} {
+		if err := r.insertTransaction(ctx, tx, transaction); err != nil {
+			r.logger.Errorf("Failed to record transaction: wallet %s, error=%v", transaction.WalletID, err)
+			return nil, err
+		}
+	}
+
+	// В книге перевод одна проводка: деньги остаются в системе
+	if err := r.postEntry(ctx, tx, models.OperationTypeTransfer, outgoing.ID,
+		walletLeg(fromID, -amount), walletLeg(toID, amount)); err != nil {
+		r.logger.Errorf("Failed to post ledger entry: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Errorf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	r.logger.Infof("Transfer success: from %s (balance %d) to %s (balance %d)", fromID, from.Amount, toID, to.Amount)
+	return outgoing, nil
+}
+
+// Reverse сторнирует операцию transactionID кошелька на сумму amount. Частичных сторно
+// может быть несколько, но в сумме не больше исходной операции
+func (r *walletRepo) Reverse(ctx context.Context, walletID, transactionID uuid.UUID, amount int64) (*models.Transaction, error) {
+	r.logger.Infof("Reverse started: walletID=%s, transactionID=%s, amount=%d", walletID, transactionID, amount)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Блокировка кошелька упорядочивает сторно одной операции: сумма предыдущих
+	// сторно ниже читается уже без гонок
+	current, err := r.lockWallet(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to lock wallet: %v", err)
+		return nil, mapNotFound(err)
+	}
+
+	if err := statusError(current.Status); err != nil {
+		r.logger.Warnf("Reverse rejected: wallet %s is %s", walletID, current.Status)
+		return nil, err
+	}
+
+	original := &models.Transaction{}
+	err = tx.GetContext(ctx, original,
+		"SELECT "+transactionColumns+" FROM wallet_transactions WHERE id = $1 AND wallet_id = $2", transactionID, walletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		r.logger.Warnf("Transaction not found: %s, wallet %s", transactionID, walletID)
+		return nil, wallet.ErrTransactionNotFound
+	}
+	if err != nil {
+		r.logger.Errorf("Failed to fetch transaction: %v", err)
+		return nil, err
+	}
+
+	credit, ok := original.ReversalCredits()
+	if !ok {
+		r.logger.Warnf("Transaction %s of type %s cannot be reversed", transactionID, original.Type)
+		return nil, wallet.ErrNotReversible
+	}
+
+	var reversed int64
+	err = tx.GetContext(ctx, &reversed,
+		"SELECT COALESCE(SUM(amount), 0) FROM wallet_transactions WHERE reversal_of = $1", transactionID)
+	if err != nil {
+		r.logger.Errorf("Failed to sum previous reversals: %v", err)
+		return nil, err
+	}
+
+	remaining := original.Amount - reversed
+	if remaining <= 0 {
+		r.logger.Warnf("Transaction %s is already fully reversed", transactionID)
+		return nil, wallet.ErrAlreadyReversed
+	}
+	if amount > remaining {
+		r.logger.Warnf("Reversal exceeds original: transaction %s, remaining: %d, amount: %d", transactionID, remaining, amount)
+		return nil, wallet.ErrReversalExceedsOriginal
+	}
+
+	// Лимиты на сторно не действуют: оно возвращает кошелек к уже разрешенному состоянию
+	query := "UPDATE wallets SET amount = amount + $1, version = version + 1, updated_at = now() WHERE wallet_id = $2"
+	if credit {
+		if amount > math.MaxInt64-current.Amount {
+			return nil, wallet.ErrBalanceOverflow
+		}
+	} else {
+		// Пополнение могло быть уже потрачено или зарезервировано
+		if current.Available() < amount {
+			r.logger.Warnf("Insufficient funds for reversal: wallet %s, available: %d, amount: %d", walletID, current.Available(), amount)
+			return nil, wallet.ErrInsufficientFunds
+		}
+		query = "UPDATE wallets SET amount = amount - $1, version = version + 1, updated_at = now() WHERE wallet_id = $2"
+	}
+
+	updated := &models.Wallet{}
+	guard, args := versionGuard(ctx, amount, walletID)
+	if err := tx.GetContext(ctx, updated, query+guard+" RETURNING "+walletColumns, args...); err != nil {
+		r.logger.Errorf("Failed to update balance: %v", err)
+		return nil, mapVersionMismatch(err)
+	}
+
+	transaction := &models.Transaction{
+		WalletID:     walletID,
+		Type:         models.TransactionTypeReversal,
+		Amount:       amount,
+		BalanceAfter: updated.Amount,
+		ReversalOf:   &transactionID,
+	}
+	if err := r.insertTransaction(ctx, tx, transaction); err != nil {
+		r.logger.Errorf("Failed to record transaction: %v", err)
+		return nil, err
+	}
+
+	// Сторно проводится через тот же системный счет, что и исходная операция
+	account, walletAmount := r.payoutAccount, amount
+	if !credit {
+		account, walletAmount = r.fundingAccount, -amount
+	}
+	if err := r.postEntry(ctx, tx, models.TransactionTypeReversal, transaction.ID,
+		walletLeg(walletID, walletAmount), systemLeg(account, -walletAmount)); err != nil {
+		r.logger.Errorf("Failed to post ledger entry: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Errorf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	r.logger.Infof("Reverse success: transaction %s, wallet %s, new balance: %d", transactionID, walletID, updated.Amount)
+	return transaction, nil
+}
+
+// CreateHold резервирует amount на кошельке до expiresAt. Проведенный баланс
+// не меняется, уменьшается только доступный
+func (r *walletRepo) CreateHold(ctx context.Context, walletID uuid.UUID, amount int64, expiresAt time.Time) (*models.Hold, error) {
+	r.logger.Infof("CreateHold started: walletID=%s, amount=%d", walletID, amount)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := r.lockWallet(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to lock wallet: %v", err)
+		return nil, mapNotFound(err)
+	}
+
+	if err := statusError(current.Status); err != nil {
+		r.logger.Warnf("Hold rejected: wallet %s is %s", walletID, current.Status)
+		return nil, err
+	}
+
+	if current.Available() < amount {
+		r.logger.Warnf("Insufficient funds: wallet %s, available: %d, amount: %d", walletID, current.Available(), amount)
+		return nil, wallet.ErrInsufficientFunds
+	}
+
+	// Холд это авторизация будущего списания: лимиты проверяются сейчас, а не при списании
+	limits, err := r.loadLimits(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to load limits: %v", err)
+		return nil, err
+	}
+	if err := r.checkDebit(ctx, tx, current, limits, amount); err != nil {
+		r.logger.Warnf("Hold rejected: wallet %s, amount: %d, error: %v", walletID, amount, err)
+		return nil, err
+	}
+
+	hold := &models.Hold{}
+	err = tx.GetContext(ctx, hold,
+		"INSERT INTO wallet_holds (id, wallet_id, amount, expires_at) VALUES ($1, $2, $3, $4) RETURNING "+holdColumns,
+		uuid.New(), walletID, amount, expiresAt)
+	if err != nil {
+		r.logger.Errorf("Failed to create hold: %v", err)
+		return nil, err
+	}
+
+	guard, args := versionGuard(ctx, amount, walletID)
+	res, err := tx.ExecContext(ctx,
+		"UPDATE wallets SET held = held + $1, version = version + 1, updated_at = now() WHERE wallet_id = $2"+guard, args...)
+	if err != nil {
+		r.logger.Errorf("Failed to update held amount: %v", err)
+		return nil, err
+	}
+	if err := checkVersionUpdated(res); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Errorf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	r.logger.Infof("Hold created: %s, wallet %s, amount %d", hold.ID, walletID, amount)
+	return hold, nil
+}
+
+// CaptureHold списывает amount из холда. Остаток холда можно списать позже
+// или снять; полностью списанный холд закрывается
+func (r *walletRepo) CaptureHold(ctx context.Context, walletID, holdID uuid.UUID, amount int64) (*models.Transaction, error) {
+	r.logger.Infof("CaptureHold started: walletID=%s, holdID=%s, amount=%d", walletID, holdID, amount)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Сначала кошелек, потом холд: в том же порядке блокирует и снятие истекших холдов
+	current, err := r.lockWallet(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to lock wallet: %v", err)
+		return nil, mapNotFound(err)
+	}
+
+	if err := statusError(current.Status); err != nil {
+		r.logger.Warnf("Capture rejected: wallet %s is %s", walletID, current.Status)
+		return nil, err
+	}
+
+	hold, err := r.lockActiveHold(ctx, tx, walletID, holdID)
+	if err != nil {
+		r.logger.Warnf("Capture rejected: hold %s, error: %v", holdID, err)
+		return nil, err
+	}
+	// Лимиты списания не проверяются: холд вошел в них при создании
+	if amount > hold.Amount {
+		r.logger.Warnf("Capture exceeds hold: hold %s, remaining: %d, amount: %d", holdID, hold.Amount, amount)
+		return nil, wallet.ErrCaptureExceedsHold
+	}
+
+	status := models.HoldStatusActive
+	if amount == hold.Amount {
+		status = models.HoldStatusCaptured
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE wallet_holds SET amount = amount - $1, captured = captured + $1, status = $2 WHERE id = $3",
+		amount, status, holdID); err != nil {
+		r.logger.Errorf("Failed to update hold: %v", err)
+		return nil, err
+	}
+
+	updated := &models.Wallet{}
+	guard, args := versionGuard(ctx, amount, walletID)
+	err = tx.GetContext(ctx, updated,
+		"UPDATE wallets SET amount = amount - $1, held = held - $1, version = version + 1, updated_at = now() WHERE wallet_id = $2"+guard+" RETURNING "+walletColumns,
+		args...)
+	if err != nil {
+		r.logger.Errorf("Failed to update balance: %v", err)
+		return nil, mapVersionMismatch(err)
+	}
+
+	transaction := &models.Transaction{
+		WalletID:     walletID,
+		Type:         models.TransactionTypeCapture,
+		Amount:       amount,
+		BalanceAfter: updated.Amount,
+	}
+	if err := r.insertTransaction(ctx, tx, transaction); err != nil {
+		r.logger.Errorf("Failed to record transaction: %v", err)
+		return nil, err
+	}
+
+	// Холд и его снятие книгу не меняют, списание по холду проводится как WITHDRAW
+	if err := r.postEntry(ctx, tx, models.TransactionTypeCapture, transaction.ID,
+		walletLeg(walletID, -amount), systemLeg(r.payoutAccount, amount)); err != nil {
+		r.logger.Errorf("Failed to post ledger entry: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Errorf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	r.logger.Infof("Capture success: hold %s, wallet %s, new balance: %d", holdID, walletID, updated.Amount)
+	return transaction, nil
+}
+
+// ReleaseHold снимает холд целиком и возвращает его остаток в доступный баланс
+func (r *walletRepo) ReleaseHold(ctx context.Context, walletID, holdID uuid.UUID) (*models.Hold, error) {
+	r.logger.Infof("ReleaseHold started: walletID=%s, holdID=%s", walletID, holdID)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Снятие только освобождает средства, поэтому разрешено и для замороженного кошелька
+	if _, err := r.lockWallet(ctx, tx, walletID); err != nil {
+		r.logger.Errorf("Failed to lock wallet: %v", err)
+		return nil, mapNotFound(err)
+	}
+
+	hold, err := r.lockActiveHold(ctx, tx, walletID, holdID)
+	if err != nil {
+		r.logger.Warnf("Release rejected: hold %s, error: %v", holdID, err)
+		return nil, err
+	}
+
+	released := &models.Hold{}
+	err = tx.GetContext(ctx, released,
+		"UPDATE wallet_holds SET status = $1 WHERE id = $2 RETURNING "+holdColumns,
+		models.HoldStatusReleased, holdID)
+	if err != nil {
+		r.logger.Errorf("Failed to release hold: %v", err)
+		return nil, err
+	}
+
+	guard, args := versionGuard(ctx, hold.Amount, walletID)
+	res, err := tx.ExecContext(ctx,
+		"UPDATE wallets SET held = held - $1, version = version + 1, updated_at = now() WHERE wallet_id = $2"+guard, args...)
+	if err != nil {
+		r.logger.Errorf("Failed to update held amount: %v", err)
+		return nil, err
+	}
+	if err := checkVersionUpdated(res); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Errorf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	r.logger.Infof("Hold released: %s, wallet %s, amount %d", holdID, walletID, hold.Amount)
+	return released, nil
+}
+
+// ExpireHolds снимает истекшие холды не более чем у limit кошельков.
+// Возвращает кошельки, у которых изменился зарезервированный баланс
+func (r *walletRepo) ExpireHolds(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	var walletIDs []uuid.UUID
+	err := r.db.SelectContext(ctx, &walletIDs,
+		"SELECT DISTINCT wallet_id FROM wallet_holds WHERE status = $1 AND expires_at <= now() LIMIT $2",
+		models.HoldStatusActive, limit)
+	if err != nil {
+		r.logger.Errorf("Failed to find expired holds: %v", err)
+		return nil, err
+	}
+
+	expired := make([]uuid.UUID, 0, len(walletIDs))
+	for _, walletID := range walletIDs {
+		ok, err := r.expireWalletHolds(ctx, walletID)
+		if err != nil {
+			r.logger.Errorf("Failed to expire holds: walletID=%s, error=%v", walletID, err)
+			return expired, err
+		}
+		if ok {
+			expired = append(expired, walletID)
+		}
+	}
+
+	return expired, nil
+}
+
+// expireWalletHolds снимает истекшие холды одного кошелька в отдельной транзакции
+func (r *walletRepo) expireWalletHolds(ctx context.Context, walletID uuid.UUID) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := r.lockWallet(ctx, tx, walletID); err != nil {
+		return false, mapNotFound(err)
+	}
+
+	// Холд могли списать или снять, пока кошелек не был заблокирован: условие проверяется заново
+	var amounts []int64
+	err = tx.SelectContext(ctx, &amounts,
+		"UPDATE wallet_holds SET status = $1 WHERE wallet_id = $2 AND status = $3 AND expires_at <= now() RETURNING amount",
+		models.HoldStatusExpired, walletID, models.HoldStatusActive)
+	if err != nil {
+		return false, err
+	}
+	if len(amounts) == 0 {
+		return false, nil
+	}
+
+	var total int64
+	for _, amount := range amounts {
+		total += amount
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE wallets SET held = held - $1, version = version + 1, updated_at = now() WHERE wallet_id = $2", total, walletID); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	r.logger.Infof("Expired %d holds: wallet %s, released %d", len(amounts), walletID, total)
+	return true, nil
+}
+
+// lockActiveHold блокирует холд кошелька и проверяет, что по нему еще можно списывать
+func (r *walletRepo) lockActiveHold(ctx context.Context, tx *sqlx.Tx, walletID, holdID uuid.UUID) (*models.Hold, error) {
+	hold := &models.Hold{}
+	err := tx.GetContext(ctx, hold,
+		"SELECT "+holdColumns+" FROM wallet_holds WHERE id = $1 AND wallet_id = $2 FOR UPDATE", holdID, walletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, wallet.ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Истекший холд, до которого еще не дошла фоновая очистка, тоже неактивен
+	if hold.Status != models.HoldStatusActive || !time.Now().Before(hold.ExpiresAt) {
+		return nil, wallet.ErrHoldNotActive
+	}
+	return hold, nil
+}
+
+// CreateWallet создаем новый кошелек с нулевым балансом в указанной валюте.
+// Если кошелек с таким ID уже есть, он возвращается как есть: совпадают ли
+// его атрибуты с запрошенными, решает вызывающий
+func (r *walletRepo) CreateWallet(ctx context.Context, w *models.Wallet) (*models.Wallet, error) {
+	r.logger.Info("CreateWallet repo called")
+
+	created := &models.Wallet{}
+	query := `INSERT INTO wallets (wallet_id, amount, currency, owner_id, label, metadata)
+		VALUES ($1, 0, $2, $3, $4, $5) ON CONFLICT (wallet_id) DO NOTHING RETURNING ` + walletColumns
+	err := r.db.GetContext(ctx, created, query, w.WalletID, w.Currency, w.OwnerID, w.Label, w.Metadata)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Строка уже есть: повтор запроса клиента или чужой кошелек с тем же ID
+		r.logger.Infof("Wallet already exists: %s", w.WalletID)
+		return r.Display(ctx, w.WalletID)
+	}
+	if err != nil {
+		r.logger.Errorf("Failed to create wallet: %v", err)
+		return nil, err
+	}
+
+	r.logger.Infof("Wallet created successfully: %s", created.WalletID)
+	return created, nil
+}
+
+// ListWallets возвращает кошельки клиента
+func (r *walletRepo) ListWallets(ctx context.Context, ownerID string) ([]models.Wallet, error) {
+	r.logger.Info("ListWallets repo called")
+
+	wallets := []models.Wallet{}
+	err := r.db.SelectContext(ctx, &wallets,
+		"SELECT "+walletColumns+" FROM wallets WHERE owner_id = $1 ORDER BY wallet_id", ownerID)
+	if err != nil {
+		r.logger.Errorf("Failed to list wallets: owner=%s, error=%v", ownerID, err)
+		return nil, err
+	}
+
+	return wallets, nil
+}
+
+// CreateSchedule сохраняет новое расписание
+func (r *walletRepo) CreateSchedule(ctx context.Context, s *models.Schedule) (*models.Schedule, error) {
+	r.logger.Infof("CreateSchedule repo called: walletID=%s, operation=%s", s.WalletID, s.OperationType)
+
+	created := &models.Schedule{}
+	err := r.db.GetContext(ctx, created,
+		`INSERT INTO wallet_schedules (id, wallet_id, operation_type, to_wallet_id, amount, recurrence, start_at, next_run_at, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8) RETURNING `+scheduleColumns,
+		s.ID, s.WalletID, s.OperationType, s.ToWalletID, s.Amount, s.Recurrence, s.StartAt, models.ScheduleStatusActive)
+	if err != nil {
+		r.logger.Errorf("Failed to create schedule: %v", err)
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// ListSchedules возвращает расписания кошелька, включая завершенные и отмененные
+func (r *walletRepo) ListSchedules(ctx context.Context, walletID uuid.UUID) ([]models.Schedule, error) {
+	r.logger.Info("ListSchedules repo called")
+
+	schedules := []models.Schedule{}
+	err := r.db.SelectContext(ctx, &schedules,
+		"SELECT "+scheduleColumns+" FROM wallet_schedules WHERE wallet_id = $1 ORDER BY created_at, id", walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to list schedules: walletID=%s, error=%v", walletID, err)
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// CancelSchedule отменяет активное расписание кошелька. Запуск, уже взятый
+// воркером в работу, отмена не останавливает
+func (r *walletRepo) CancelSchedule(ctx context.Context, walletID, scheduleID uuid.UUID) (*models.Schedule, error) {
+	r.logger.Infof("CancelSchedule repo called: walletID=%s, scheduleID=%s", walletID, scheduleID)
+
+	cancelled := &models.Schedule{}
+	err := r.db.GetContext(ctx, cancelled,
+		"UPDATE wallet_schedules SET status = $1 WHERE id = $2 AND wallet_id = $3 AND status = $4 RETURNING "+scheduleColumns,
+		models.ScheduleStatusCancelled, scheduleID, walletID, models.ScheduleStatusActive)
+	if err == nil {
+		return cancelled, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		r.logger.Errorf("Failed to cancel schedule: %v", err)
+		return nil, err
+	}
+
+	// Ничего не обновилось: расписания нет либо оно уже не активно
+	if err := r.scheduleExists(ctx, walletID, scheduleID); err != nil {
+		return nil, err
+	}
+	return nil, wallet.ErrScheduleNotActive
+}
+
+// GetScheduleExecutions возвращает последние limit запусков расписания, новые первыми
+func (r *walletRepo) GetScheduleExecutions(ctx context.Context, walletID, scheduleID uuid.UUID, limit int) ([]models.ScheduleExecution, error) {
+	r.logger.Info("GetScheduleExecutions repo called")
+
+	if err := r.scheduleExists(ctx, walletID, scheduleID); err != nil {
+		return nil, err
+	}
+
+	executions := []models.ScheduleExecution{}
+	err := r.db.SelectContext(ctx, &executions,
+		"SELECT "+executionColumns+" FROM wallet_schedule_executions WHERE schedule_id = $1 ORDER BY run_at DESC, id DESC LIMIT $2",
+		scheduleID, limit)
+	if err != nil {
+		r.logger.Errorf("Failed to fetch schedule executions: scheduleID=%s, error=%v", scheduleID, err)
+		return nil, err
+	}
+
+	return executions, nil
+}
+
+// scheduleExists проверяет, что расписание принадлежит кошельку
+func (r *walletRepo) scheduleExists(ctx context.Context, walletID, scheduleID uuid.UUID) error {
+	var exists bool
+	err := r.db.GetContext(ctx, &exists,
+		"SELECT EXISTS (SELECT 1 FROM wallet_schedules WHERE id = $1 AND wallet_id = $2)", scheduleID, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to check schedule: %v", err)
+		return err
+	}
+	if !exists {
+		return wallet.ErrScheduleNotFound
+	}
+	return nil
+}
+
+// ClaimDueSchedules берет в работу до limit наступивших запусков. Расписания
+// блокируются с SKIP LOCKED, поэтому реплики разбирают разные строки, а сдвиг
+// на следующий запуск коммитится до выполнения операции: один запуск выполняется
+// не больше одного раза даже при падении реплики
+func (r *walletRepo) ClaimDueSchedules(ctx context.Context, limit int) ([]models.ScheduledRun, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var due []models.Schedule
+	err = tx.SelectContext(ctx, &due,
+		"SELECT "+scheduleColumns+" FROM wallet_schedules WHERE status = $1 AND next_run_at <= now() ORDER BY next_run_at LIMIT $2 FOR UPDATE SKIP LOCKED",
+		models.ScheduleStatusActive, limit)
+	if err != nil {
+		r.logger.Errorf("Failed to select due schedules: %v", err)
+		return nil, err
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	runs := make([]models.ScheduledRun, 0, len(due))
+	for _, s := range due {
+		run := models.ScheduledRun{
+			Schedule: s,
+			Execution: models.ScheduleExecution{
+				ID:         uuid.New(),
+				ScheduleID: s.ID,
+				RunAt:      s.NextRunAt,
+				Status:     models.ExecutionStatusPending,
+			},
+		}
+
+		s.Advance(now)
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE wallet_schedules SET next_run_at = $1, iteration = $2, status = $3 WHERE id = $4",
+			s.NextRunAt, s.Iteration, s.Status, s.ID); err != nil {
+			r.logger.Errorf("Failed to advance schedule %s: %v", s.ID, err)
+			return nil, err
+		}
+
+		err := tx.GetContext(ctx, &run.Execution.StartedAt,
+			"INSERT INTO wallet_schedule_executions (id, schedule_id, run_at, status) VALUES ($1, $2, $3, $4) RETURNING started_at",
+			run.Execution.ID, run.Execution.ScheduleID, run.Execution.RunAt, run.Execution.Status)
+		if err != nil {
+			r.logger.Errorf("Failed to record schedule execution: %v", err)
+			return nil, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Errorf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// CompleteScheduleExecution записывает результат запуска расписания
+func (r *walletRepo) CompleteScheduleExecution(ctx context.Context, execution *models.ScheduleExecution) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE wallet_schedule_executions SET status = $1, transaction_id = $2, error = $3, finished_at = now() WHERE id = $4",
+		execution.Status, execution.TransactionID, execution.Error, execution.ID)
+	if err != nil {
+		r.logger.Errorf("Failed to complete schedule execution %s: %v", execution.ID, err)
+	}
+	return err
+}
+
+// UpdateStatus переводит кошелек в новый статус. Допустимость перехода и нулевой
+// баланс при закрытии проверяются под блокировкой строки, чтобы параллельное
+// пополнение не проскочило между проверкой и закрытием
+func (r *walletRepo) UpdateStatus(ctx context.Context, walletID uuid.UUID, status string) (*models.Wallet, error) {
+	r.logger.Infof("UpdateStatus started: walletID=%s, status=%s", walletID, status)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := r.lockWallet(ctx, tx, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to lock wallet: %v", err)
+		return nil, mapNotFound(err)
+	}
+
+	// Повторный запрос того же статуса ничего не меняет
+	if current.Status == status {
+		return current, nil
+	}
+	if !current.CanTransitionTo(status) {
+		r.logger.Warnf("Invalid status transition: wallet %s, %s -> %s", walletID, current.Status, status)
+		return nil, wallet.ErrInvalidStatusTransition
+	}
+	if status == models.WalletStatusClosed && current.Amount != 0 {
+		r.logger.Warnf("Close rejected: wallet %s, balance: %d", walletID, current.Amount)
+		return nil, wallet.ErrWalletNotEmpty
+	}
+
+	updated := &models.Wallet{}
+	err = tx.GetContext(ctx, updated,
+		"UPDATE wallets SET status = $1, version = version + 1, updated_at = now() WHERE wallet_id = $2 RETURNING "+walletColumns,
+		status, walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to update status: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Errorf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	r.logger.Infof("Wallet %s status changed: %s -> %s", walletID, current.Status, updated.Status)
+	return updated, nil
+}
+
+// GetTransactions возвращает журнал операций кошелька с учетом фильтра.
+// Пагинация по ключу (created_at, id), поэтому страницы стабильны при новых записях
+func (r *walletRepo) GetTransactions(ctx context.Context, walletID uuid.UUID, filter models.TransactionFilter) ([]models.Transaction, error) {
+	r.logger.Info("GetTransactions repo called")
+
+	query := "SELECT " + transactionColumns + " FROM wallet_transactions WHERE wallet_id = $1"
+	args := []interface{}{walletID}
+
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		query += fmt.Sprintf(" AND type = $%d", len(args))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+
+	order, cmp := "DESC", "<"
+	if filter.Ascending {
+		order, cmp = "ASC", ">"
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.CreatedAt, filter.After.ID)
+		query += fmt.Sprintf(" AND (created_at, id) %s ($%d, $%d)", cmp, len(args)-1, len(args))
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT $%d", order, order, len(args))
+
+	transactions := []models.Transaction{}
+	if err := r.db.SelectContext(ctx, &transactions, query, args...); err != nil {
+		r.logger.Errorf("Failed to get transactions: walletID=%s, error=%v", walletID, err)
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// CheckLedger сверяет главную книгу целиком: каждая проводка сходится в ноль, баланс
+// каждого кошелька равен сумме его ног, и сумма всех ног книги равна нулю.
+// Запросы идут в одном снимке REPEATABLE READ, чтобы параллельные операции не давали ложных расхождений
+func (r *walletRepo) CheckLedger(ctx context.Context) (*models.LedgerCheck, error) {
+	r.logger.Info("CheckLedger repo called")
+
+	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		r.logger.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	check := &models.LedgerCheck{
+		UnbalancedEntries: []uuid.UUID{},
+		MismatchedWallets: []uuid.UUID{},
+		SystemAccounts:    map[string]int64{},
+	}
+
+	err = tx.SelectContext(ctx, &check.UnbalancedEntries,
+		`SELECT entry_id FROM ledger_postings GROUP BY entry_id HAVING SUM(amount) <> 0 ORDER BY entry_id LIMIT $1`,
+		ledgerCheckLimit)
+	if err != nil {
+		r.logger.Errorf("Failed to check ledger entries: %v", err)
+		return nil, err
+	}
+
+	err = tx.SelectContext(ctx, &check.MismatchedWallets,
+		`SELECT w.wallet_id FROM wallets w
+		LEFT JOIN (SELECT wallet_id, SUM(amount) AS amount FROM ledger_postings WHERE wallet_id IS NOT NULL GROUP BY wallet_id) p
+			ON p.wallet_id = w.wallet_id
+		WHERE w.amount <> COALESCE(p.amount, 0) ORDER BY w.wallet_id LIMIT $1`,
+		ledgerCheckLimit)
+	if err != nil {
+		r.logger.Errorf("Failed to check wallet balances against ledger: %v", err)
+		return nil, err
+	}
+
+	var accounts []struct {
+		Account string `db:"system_account"`
+		Amount  int64  `db:"amount"`
+	}
+	err = tx.SelectContext(ctx, &accounts,
+		`SELECT system_account, SUM(amount) AS amount FROM ledger_postings
+		WHERE system_account IS NOT NULL GROUP BY system_account`)
+	if err != nil {
+		r.logger.Errorf("Failed to sum system accounts: %v", err)
+		return nil, err
+	}
+	for _, a := range accounts {
+		check.SystemAccounts[a.Account] = a.Amount
+	}
+
+	if err := tx.GetContext(ctx, &check.Total, `SELECT COALESCE(SUM(amount), 0) FROM ledger_postings`); err != nil {
+		r.logger.Errorf("Failed to sum ledger: %v", err)
+		return nil, err
+	}
+
+	check.Balanced = len(check.UnbalancedEntries) == 0 && len(check.MismatchedWallets) == 0 && check.Total == 0
+	return check, nil
+}
+
+// GetLimits возвращает действующие лимиты кошелька с подставленными значениями по умолчанию
+func (r *walletRepo) GetLimits(ctx context.Context, walletID uuid.UUID) (*models.WalletLimits, error) {
+	r.logger.Info("GetLimits repo called")
+
+	// LEFT JOIN отличает кошелек без своих лимитов от несуществующего
+	stored := models.WalletLimits{}
+	err := r.db.GetContext(ctx, &stored,
+		`SELECT w.wallet_id, l.max_operation_amount, l.max_balance, l.daily_withdrawal_limit, l.monthly_withdrawal_limit
+		FROM wallets w LEFT JOIN wallet_limits l ON l.wallet_id = w.wallet_id WHERE w.wallet_id = $1`,
+		walletID)
+	if err != nil {
+		r.logger.Errorf("Failed to get limits: walletID=%s, error=%v", walletID, err)
+		return nil, mapNotFound(err)
+	}
+
+	limits := stored.WithDefaults(r.defaultLimits)
+	return &limits, nil
+}
+
+// SetLimits сохраняет собственные лимиты кошелька. nil в поле возвращает лимит по умолчанию
+func (r *walletRepo) SetLimits(ctx context.Context, limits *models.WalletLimits) (*models.WalletLimits, error) {
+	r.logger.Infof("SetLimits repo called: walletID=%s", limits.WalletID)
+
+	query := `INSERT INTO wallet_limits (wallet_id, max_operation_amount, max_balance, daily_withdrawal_limit, monthly_withdrawal_limit)
+		SELECT $1, $2, $3, $4, $5 WHERE EXISTS (SELECT 1 FROM wallets WHERE wallet_id = $1)
+		ON CONFLICT (wallet_id) DO UPDATE SET
+			max_operation_amount = EXCLUDED.max_operation_amount,
+			max_balance = EXCLUDED.max_balance,
+			daily_withdrawal_limit = EXCLUDED.daily_withdrawal_limit,
+			monthly_withdrawal_limit = EXCLUDED.monthly_withdrawal_limit`
+	res, err := r.db.ExecContext(ctx, query, limits.WalletID, limits.MaxOperationAmount, limits.MaxBalance,
+		limits.DailyWithdrawalLimit, limits.MonthlyWithdrawalLimit)
+	if err != nil {
+		r.logger.Errorf("Failed to set limits: walletID=%s, error=%v", limits.WalletID, err)
+		return nil, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, wallet.ErrWalletNotFound
+	}
+
+	return r.GetLimits(ctx, limits.WalletID)
+}
+
+// loadLimits читает действующие лимиты кошелька внутри транзакции
+func (r *walletRepo) loadLimits(ctx context.Context, tx *sqlx.Tx, walletID uuid.UUID) (models.WalletLimits, error) {
+	stored := models.WalletLimits{WalletID: walletID}
+	err := tx.GetContext(ctx, &stored,
+		`SELECT wallet_id, max_operation_amount, max_balance, daily_withdrawal_limit, monthly_withdrawal_limit
+		FROM wallet_limits WHERE wallet_id = $1`,
+		walletID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.WalletLimits{}, err
+	}
+	return stored.WithDefaults(r.defaultLimits), nil
+}
+
+// checkCredit проверяет лимиты пополнения кошелька с балансом balance
+func checkCredit(limits models.WalletLimits, balance, amount int64) error {
+	if exceeds(limits.MaxOperationAmount, amount) {
+		return wallet.ErrOperationLimitExceeded
+	}
+	// balance+amount может переполнить int64, поэтому сравниваем с остатком до границы
+	if amount > math.MaxInt64-balance {
+		return wallet.ErrBalanceOverflow
+	}
+	if limited(limits.MaxBalance) && amount > *limits.MaxBalance-balance {
+		return wallet.ErrBalanceLimitExceeded
+	}
+	return nil
+}
+
+// checkDebit проверяет лимиты списания. Суммы за окна считаются по журналу
+// под блокировкой строки кошелька, поэтому параллельные списания их не обойдут.
+// Активные холды уже авторизованы как списания и входят в обе суммы: при списании
+// по холду лимиты не проверяются, иначе несколько холдов вместе обошли бы лимит.
+// current заблокированная строка кошелька
+func (r *walletRepo) checkDebit(ctx context.Context, tx *sqlx.Tx, current *models.Wallet, limits models.WalletLimits, amount int64) error {
+	if exceeds(limits.MaxOperationAmount, amount) {
+		return wallet.ErrOperationLimitExceeded
+	}
+	if !limited(limits.DailyWithdrawalLimit) && !limited(limits.MonthlyWithdrawalLimit) {
+		// Без лимитов по окнам журнал не читаем
+		return nil
+	}
+
+	var totals struct {
+		Daily   int64 `db:"daily"`
+		Monthly int64 `db:"monthly"`
+	}
+	err := tx.GetContext(ctx, &totals,
+		`SELECT COALESCE(SUM(amount) FILTER (WHERE created_at > now() - interval '1 day'), 0) AS daily,
+			COALESCE(SUM(amount), 0) AS monthly
+		FROM wallet_transactions
+		WHERE wallet_id = $1 AND type IN ($2, $3, $4) AND created_at > now() - interval '30 days'`,
+		current.WalletID, models.TransactionTypeWithdraw, models.TransactionTypeTransferOut, models.TransactionTypeCapture)
+	if err != nil {
+		return fmt.Errorf("failed to sum withdrawals: %w", err)
+	}
+	totals.Daily += current.Held
+	totals.Monthly += current.Held
+
+	if exceeds(limits.DailyWithdrawalLimit, totals.Daily+amount) {
+		return wallet.ErrDailyWithdrawalLimitExceeded
+	}
+	if exceeds(limits.MonthlyWithdrawalLimit, totals.Monthly+amount) {
+		return wallet.ErrMonthlyWithdrawalLimitExceeded
+	}
+	return nil
+}
+
+// limited true, если лимит задан и не равен нулю
+func limited(limit *int64) bool {
+	return limit != nil && *limit > 0
+}
+
+// exceeds true, если лимит действует и value больше него
+func exceeds(limit *int64, value int64) bool {
+	return limited(limit) && value > *limit
+}
+
+// lockWallet блокирует строку кошелька до конца транзакции и возвращает ее текущее состояние
+func (r *walletRepo) lockWallet(ctx context.Context, tx *sqlx.Tx, walletID uuid.UUID) (*models.Wallet, error) {
+	w := &models.Wallet{}
+	err := tx.GetContext(ctx, w, "SELECT "+walletColumns+" FROM wallets WHERE wallet_id = $1 FOR UPDATE", walletID)
+	return w, err
+}
+
+// statusError доменная ошибка для кошелька, который не принимает операции
+func statusError(status string) error {
+	switch status {
+	case models.WalletStatusFrozen:
+		return wallet.ErrWalletFrozen
+	case models.WalletStatusClosed:
+		return wallet.ErrWalletClosed
+	default:
+		return nil
+	}
+}
+
+// insertTransaction добавляет запись в журнал операций внутри переданной транзакции
+func (r *walletRepo) insertTransaction(ctx context.Context, tx *sqlx.Tx, transaction *models.Transaction) error {
+	transaction.ID = uuid.New()
+
+	query := `INSERT INTO wallet_transactions (id, wallet_id, type, amount, balance_after, counterparty_id, reversal_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at`
+	return tx.GetContext(ctx, &transaction.CreatedAt, query,
+		transaction.ID, transaction.WalletID, transaction.Type, transaction.Amount,
+		transaction.BalanceAfter, transaction.CounterpartyID, transaction.ReversalOf)
+}
+
+// postEntry записывает проводку главной книги из ног legs. Ноги должны сходиться в ноль:
+// деньги не появляются и не исчезают, а переходят между счетами
+func (r *walletRepo) postEntry(ctx context.Context, tx *sqlx.Tx, entryType string, transactionID uuid.UUID, legs ...models.Posting) error {
+	var sum int64
+	for _, leg := range legs {
+		sum += leg.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("unbalanced %s ledger entry: legs sum to %d", entryType, sum)
+	}
+
+	entryID := uuid.New()
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO ledger_entries (id, type, transaction_id) VALUES ($1, $2, $3)",
+		entryID, entryType, transactionID); err != nil {
 		return err
 	}
 
-	r.logger.Infof("Withdraw success: wallet %s, new balance: %d", walletID, newBalance)
+	query := "INSERT INTO ledger_postings (entry_id, leg, wallet_id, system_account, amount) VALUES "
+	args := []interface{}{entryID}
+	for i, leg := range legs {
+		if i > 0 {
+			query += ", "
+		}
+		n := len(args)
+		query += fmt.Sprintf("($1, %d, $%d, $%d, $%d)", i+1, n+1, n+2, n+3)
+		args = append(args, leg.WalletID, leg.SystemAccount, leg.Amount)
+	}
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// walletLeg нога проводки по счету кошелька
+func walletLeg(walletID uuid.UUID, amount int64) models.Posting {
+	return models.Posting{WalletID: &walletID, Amount: amount}
+}
+
+// systemLeg нога проводки по системному счету
+func systemLeg(account string, amount int64) models.Posting {
+	return models.Posting{SystemAccount: &account, Amount: amount}
+}
+
+// versionGuard дополняет UPDATE кошелька условием оптимистической блокировки, если
+// клиент передал ожидаемую версию (If-Match). Возвращает условие и аргументы запроса с версией
+func versionGuard(ctx context.Context, args ...interface{}) (string, []interface{}) {
+	version, ok := wallet.ExpectedVersion(ctx)
+	if !ok {
+		return "", args
+	}
+	return fmt.Sprintf(" AND version = $%d", len(args)+1), append(args, version)
+}
+
+// mapVersionMismatch UPDATE с условием на версию не вернул строку. Кошелек уже
+// заблокирован в этой транзакции, поэтому строка есть, а версия изменилась
+func mapVersionMismatch(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return wallet.ErrVersionMismatch
+	}
+	return err
+}
+
+// checkVersionUpdated то же для UPDATE без RETURNING
+func checkVersionUpdated(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return wallet.ErrVersionMismatch
+	}
 	return nil
 }
 
-// CreateWallet создаем новый кошелек с нулевым балансом
-func (r *walletRepo) CreateWallet(ctx context.Context, walletID uuid.UUID) (uuid.UUID, error) {
-	r.logger.Info("CreateWallet repo called")
+// mapNotFound переводит отсутствие строки кошелька в доменную ошибку
+func mapNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return wallet.ErrWalletNotFound
+	}
+	return err
+}
+
+// ReserveIdempotencyKey занимает ключ идемпотентности. Если ключ свободен,
+// возвращает nil, иначе возвращает уже сохраненную запись.
+// Незавершенный резерв того же запроса старше idempotencyTimeout считается брошенным
+// и перехватывается: время резерва обновляется, и операция выполняется заново
+func (r *walletRepo) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*models.IdempotencyKey, error) {
+	r.logger.Info("ReserveIdempotencyKey repo called")
 
-	// walletID := uuid.New()
+	query := "INSERT INTO idempotency_keys (key, request_hash) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING"
+	args := []interface{}{key, requestHash}
+	if r.idempotencyTimeout > 0 {
+		query = `INSERT INTO idempotency_keys (key, request_hash) VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE SET created_at = now()
+			WHERE idempotency_keys.status_code = 0 AND idempotency_keys.request_hash = EXCLUDED.request_hash
+				AND idempotency_keys.created_at < now() - $3 * interval '1 millisecond'`
+		args = append(args, r.idempotencyTimeout.Milliseconds())
+	}
 
-	query := `INSERT INTO wallets (wallet_id, amount) VALUES ($1, 0) RETURNING wallet_id`
-	err := r.db.QueryRowContext(ctx, query, walletID).Scan(&walletID)
+	res, err := r.db.ExecContext(ctx, query, args...)
 	if err != nil {
-		r.logger.Errorf("Failed to create wallet: %v", err)
-		return uuid.UUID{}, err
+		r.logger.Errorf("Failed to reserve idempotency key: key=%s, error=%v", key, err)
+		return nil, err
 	}
 
-	// Обновляем кэш в Redis
-	cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
-	if err := r.redisClient.Set(ctx, cacheKey, 0, 10*time.Minute).Err(); err != nil {
-		r.logger.Error("error:", err)
-		r.logger.Warnf("Failed to update Redis cache: %v", err)
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if inserted == 1 {
+		return nil, nil
+	}
+
+	// Ключ уже занят: отдаем сохраненную запись для повтора или проверки конфликта
+	record := &models.IdempotencyKey{}
+	err = r.db.GetContext(ctx, record,
+		`SELECT key, request_hash, status_code, response, created_at FROM idempotency_keys WHERE key = $1`, key)
+	if err != nil {
+		r.logger.Errorf("Failed to get idempotency key: key=%s, error=%v", key, err)
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// CompleteIdempotencyKey сохраняет результат операции под ключом идемпотентности
+func (r *walletRepo) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	r.logger.Info("CompleteIdempotencyKey repo called")
+
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE idempotency_keys SET status_code = $1, response = $2 WHERE key = $3",
+		statusCode, response, key)
+	if err != nil {
+		r.logger.Errorf("Failed to complete idempotency key: key=%s, error=%v", key, err)
+		return err
 	}
 
-	r.logger.Infof("Wallet created successfully: %s", walletID)
-	return walletID, nil
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает незавершенный ключ, чтобы клиент мог повторить запрос
+func (r *walletRepo) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	r.logger.Info("ReleaseIdempotencyKey repo called")
+
+	_, err := r.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND status_code = 0", key)
+	if err != nil {
+		r.logger.Errorf("Failed to release idempotency key: key=%s, error=%v", key, err)
+		return err
+	}
+
+	return nil
 }
@@ -2,74 +2,120 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"fmt"
+	"math"
 	"testing"
 	"time"
 
+	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
+	"github.com/22Fariz22/wallet/internal/wallet"
 	"github.com/22Fariz22/wallet/pkg/logger"
 	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/go-redis/redismock/v9"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 )
 
+// walletCols колонки снимка кошелька, как в walletColumns
+var walletCols = []string{"wallet_id", "amount", "currency", "version", "status", "owner_id", "label", "metadata", "held", "created_at", "updated_at"}
+
+var walletTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// walletRows строки результата запроса кошелька для sqlmock
+func walletRows(walletID uuid.UUID, amount int64) *sqlmock.Rows {
+	return statusRows(walletID, amount, models.WalletStatusActive)
+}
+
+// statusRows строка кошелька с заданным статусом
+func statusRows(walletID uuid.UUID, amount int64, status string) *sqlmock.Rows {
+	return sqlmock.NewRows(walletCols).
+		AddRow(walletID, amount, "RUB", 1, status, "", "", []byte("{}"), 0, walletTime, walletTime)
+}
+
+// heldRows активный кошелек, часть баланса которого зарезервирована холдами
+func heldRows(walletID uuid.UUID, amount, held int64) *sqlmock.Rows {
+	return sqlmock.NewRows(walletCols).
+		AddRow(walletID, amount, "RUB", 1, models.WalletStatusActive, "", "", []byte("{}"), held, walletTime, walletTime)
+}
+
+const (
+	lockWalletQuery = "SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = \\$1 FOR UPDATE"
+	limitsQuery     = "SELECT wallet_id, max_operation_amount, max_balance, daily_withdrawal_limit, monthly_withdrawal_limit FROM wallet_limits WHERE wallet_id = \\$1"
+	totalsQuery     = "SELECT (.+) AS daily, (.+) AS monthly FROM wallet_transactions WHERE wallet_id = \\$1 AND type IN \\(\\$2, \\$3, \\$4\\)"
+)
+
+// expectNoLimits кошелек без собственных лимитов: действуют лимиты по умолчанию
+func expectNoLimits(sqlMock sqlmock.Sqlmock, walletID uuid.UUID) {
+	sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnError(sql.ErrNoRows)
+}
+
+// limitRows строка собственных лимитов кошелька, nil означает лимит по умолчанию
+func limitRows(walletID uuid.UUID, maxOperation, maxBalance, daily, monthly *int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"wallet_id", "max_operation_amount", "max_balance", "daily_withdrawal_limit", "monthly_withdrawal_limit"}).
+		AddRow(walletID, maxOperation, maxBalance, daily, monthly)
+}
+
+// expectLedgerEntry проводка главной книги: запись проводки и ее ноги
+func expectLedgerEntry(sqlMock sqlmock.Sqlmock, entryType string) {
+	sqlMock.ExpectExec("INSERT INTO ledger_entries").
+		WithArgs(sqlmock.AnyArg(), entryType, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec("INSERT INTO ledger_postings").WillReturnResult(sqlmock.NewResult(0, 2))
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
 func TestWalletRepo_Display(t *testing.T) {
 	db, sqlMock, _ := sqlmock.New()
 	defer db.Close()
 
-	mockRedis, redisMock := redismock.NewClientMock()
-
 	logger := logger.NewMockLogger()
 
-	repo := NewWalletRepository(sqlx.NewDb(db, "postgres"), logger, mockRedis)
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger)
 
-	t.Run("Success from Redis", func(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
 		walletID := uuid.New()
-		cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
 
-		redisMock.ExpectGet(cacheKey).SetVal("500")
+		sqlMock.ExpectQuery("SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = ?").
+			WithArgs(walletID).WillReturnRows(walletRows(walletID, 500))
 
-		balance, err := repo.Display(context.Background(), walletID)
+		w, err := repo.Display(context.Background(), walletID)
 
 		assert.NoError(t, err)
-		assert.Equal(t, int64(500), balance)
-		redisMock.ExpectationsWereMet()
+		assert.Equal(t, int64(500), w.Amount)
+		assert.Equal(t, walletTime, w.UpdatedAt)
+		sqlMock.ExpectationsWereMet()
 	})
 
-	t.Run("Success from DB", func(t *testing.T) {
+	t.Run("DB Failure", func(t *testing.T) {
 		walletID := uuid.New()
-		cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
 
-		redisMock.ExpectGet(cacheKey).RedisNil()
-
-		sqlMock.ExpectQuery("SELECT amount FROM wallets WHERE wallet_id = ?").
-			WithArgs(walletID).WillReturnRows(sqlmock.NewRows([]string{"amount"}).AddRow(500))
+		sqlMock.ExpectQuery(
+			"SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = ?",
+		).WithArgs(walletID).WillReturnError(errors.New("db error"))
 
-		redisMock.ExpectSet(cacheKey, "500", 10*time.Minute).SetVal("OK")
-		balance, err := repo.Display(context.Background(), walletID)
+		w, err := repo.Display(context.Background(), walletID)
 
-		assert.NoError(t, err)
-		assert.Equal(t, int64(500), balance)
-		redisMock.ExpectationsWereMet()
+		assert.Error(t, err)
+		assert.Nil(t, w)
 		sqlMock.ExpectationsWereMet()
 	})
 
-	t.Run("Failure from DB", func(t *testing.T) {
+	t.Run("Wallet Not Found", func(t *testing.T) {
 		walletID := uuid.New()
-		cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
 
-		redisMock.ExpectGet(cacheKey).RedisNil()
 		sqlMock.ExpectQuery(
-			"SELECT amount FROM wallets WHERE wallet_id = ?",
-		).WithArgs(walletID).WillReturnError(errors.New("db error"))
+			"SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = ?",
+		).WithArgs(walletID).WillReturnError(sql.ErrNoRows)
 
-		balance, err := repo.Display(context.Background(), walletID)
+		_, err := repo.Display(context.Background(), walletID)
 
-		assert.Error(t, err)
-		assert.Equal(t, int64(0), balance)
-		sqlMock.ExpectationsWereMet()
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
 	})
 }
 
@@ -77,30 +123,36 @@ func TestWalletRepo_Deposit(t *testing.T) {
 	db, sqlMock, _ := sqlmock.New()
 	defer db.Close()
 
-	mockRedis, redisMock := redismock.NewClientMock()
 	logger := logger.NewMockLogger()
 
-	repo := NewWalletRepository(sqlx.NewDb(db, "postgres"), logger, mockRedis)
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger)
 
 	t.Run("Success", func(t *testing.T) {
 		walletID := uuid.New()
 		amount := int64(100)
 		newBalance := int64(200)
-		cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
 
 		sqlMock.ExpectBegin()
-		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1 WHERE wallet_id = \\$2 RETURNING amount").
+		sqlMock.ExpectQuery(lockWalletQuery).
+			WithArgs(walletID).
+			WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
 			WithArgs(amount, walletID).
-			WillReturnRows(sqlmock.NewRows([]string{"amount"}).AddRow(newBalance))
+			WillReturnRows(walletRows(walletID, newBalance))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), walletID, models.TransactionTypeDeposit, amount, newBalance, nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeDeposit)
 		sqlMock.ExpectCommit()
 
-		redisMock.ExpectSet(cacheKey, newBalance, 10*time.Minute).SetVal("OK")
-
-		err := repo.Deposit(context.Background(), walletID, amount)
+		transaction, err := repo.Deposit(context.Background(), walletID, amount)
 
 		assert.NoError(t, err)
+		assert.Equal(t, walletID, transaction.WalletID)
+		assert.Equal(t, models.TransactionTypeDeposit, transaction.Type)
+		assert.Equal(t, newBalance, transaction.BalanceAfter)
 		assert.Nil(t, sqlMock.ExpectationsWereMet())
-		assert.Nil(t, redisMock.ExpectationsWereMet())
 	})
 
 	t.Run("DB Failure", func(t *testing.T) {
@@ -108,47 +160,151 @@ func TestWalletRepo_Deposit(t *testing.T) {
 		amount := int64(100)
 
 		sqlMock.ExpectBegin()
-		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1 WHERE wallet_id = \\$2 RETURNING amount").
+		sqlMock.ExpectQuery(lockWalletQuery).
+			WithArgs(walletID).
+			WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
 			WithArgs(amount, walletID).
 			WillReturnError(errors.New("db error"))
 		sqlMock.ExpectRollback()
 
-		err := repo.Deposit(context.Background(), walletID, amount)
+		_, err := repo.Deposit(context.Background(), walletID, amount)
 
 		assert.Error(t, err)
 		assert.Equal(t, "failed to update balance: db error", err.Error())
 		assert.Nil(t, sqlMock.ExpectationsWereMet())
 	})
+
+	t.Run("Ledger Failure", func(t *testing.T) {
+		walletID := uuid.New()
+		amount := int64(100)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).
+			WithArgs(walletID).
+			WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
+			WithArgs(amount, walletID).
+			WillReturnRows(walletRows(walletID, amount))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WillReturnError(errors.New("ledger error"))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Deposit(context.Background(), walletID, amount)
+
+		assert.Error(t, err)
+		assert.Equal(t, "failed to record transaction: ledger error", err.Error())
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Commit Failure", func(t *testing.T) {
+		walletID := uuid.New()
+		amount := int64(100)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).
+			WithArgs(walletID).
+			WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
+			WithArgs(amount, walletID).
+			WillReturnRows(walletRows(walletID, amount))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeDeposit)
+		sqlMock.ExpectCommit().WillReturnError(errors.New("commit error"))
+
+		_, err := repo.Deposit(context.Background(), walletID, amount)
+
+		assert.Error(t, err)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_DepositInactive(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+
+	tests := []struct {
+		name   string
+		status string
+		err    error
+	}{
+		{"Frozen", models.WalletStatusFrozen, wallet.ErrWalletFrozen},
+		{"Closed", models.WalletStatusClosed, wallet.ErrWalletClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walletID := uuid.New()
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(lockWalletQuery).
+				WithArgs(walletID).
+				WillReturnRows(statusRows(walletID, 100, tt.status))
+			sqlMock.ExpectRollback()
+
+			_, err := repo.Deposit(context.Background(), walletID, 100)
+
+			assert.ErrorIs(t, err, tt.err)
+			assert.Nil(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("Not Found", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).
+			WithArgs(walletID).
+			WillReturnError(sql.ErrNoRows)
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Deposit(context.Background(), walletID, 100)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
 }
 
 func TestWalletRepo_Withdraw(t *testing.T) {
 	db, sqlMock, _ := sqlmock.New()
 	defer db.Close()
 
-	mockRedis, redisMock := redismock.NewClientMock()
 	logger := logger.NewMockLogger()
 
-	repo := NewWalletRepository(sqlx.NewDb(db, "postgres"), logger, mockRedis)
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger)
 
 	t.Run("Success", func(t *testing.T) {
 		walletID := uuid.New()
 		amount := int64(50)
 		newBalance := int64(150)
-		cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
 
 		sqlMock.ExpectBegin()
-		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1 WHERE wallet_id = \\$2 RETURNING amount").
+		sqlMock.ExpectQuery("SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = \\$1 FOR UPDATE").
+			WithArgs(walletID).
+			WillReturnRows(walletRows(walletID, 200))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
 			WithArgs(amount, walletID).
-			WillReturnRows(sqlmock.NewRows([]string{"amount"}).AddRow(newBalance))
+			WillReturnRows(walletRows(walletID, newBalance))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), walletID, models.TransactionTypeWithdraw, amount, newBalance, nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeWithdraw)
 		sqlMock.ExpectCommit()
 
-		redisMock.ExpectSet(cacheKey, newBalance, 10*time.Minute).SetVal("OK")
-
-		err := repo.Withdraw(context.Background(), walletID, amount)
+		transaction, err := repo.Withdraw(context.Background(), walletID, amount)
 
 		assert.NoError(t, err)
+		assert.Equal(t, walletID, transaction.WalletID)
+		assert.Equal(t, models.TransactionTypeWithdraw, transaction.Type)
+		assert.Equal(t, newBalance, transaction.BalanceAfter)
 		assert.Nil(t, sqlMock.ExpectationsWereMet())
-		assert.Nil(t, redisMock.ExpectationsWereMet())
 	})
 
 	t.Run("Insufficient Funds", func(t *testing.T) {
@@ -156,15 +312,14 @@ func TestWalletRepo_Withdraw(t *testing.T) {
 		amount := int64(500)
 
 		sqlMock.ExpectBegin()
-		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1 WHERE wallet_id = \\$2 RETURNING amount").
-			WithArgs(amount, walletID).
-			WillReturnError(errors.New("insufficient funds"))
+		sqlMock.ExpectQuery("SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = \\$1 FOR UPDATE").
+			WithArgs(walletID).
+			WillReturnRows(walletRows(walletID, 100))
 		sqlMock.ExpectRollback()
 
-		err := repo.Withdraw(context.Background(), walletID, amount)
+		_, err := repo.Withdraw(context.Background(), walletID, amount)
 
-		assert.Error(t, err)
-		assert.Equal(t, "insufficient funds", err.Error())
+		assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
 		assert.Nil(t, sqlMock.ExpectationsWereMet())
 	})
 
@@ -173,12 +328,16 @@ func TestWalletRepo_Withdraw(t *testing.T) {
 		amount := int64(100)
 
 		sqlMock.ExpectBegin()
-		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1 WHERE wallet_id = \\$2 RETURNING amount").
+		sqlMock.ExpectQuery("SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = \\$1 FOR UPDATE").
+			WithArgs(walletID).
+			WillReturnRows(walletRows(walletID, 200))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
 			WithArgs(amount, walletID).
 			WillReturnError(errors.New("db error"))
 		sqlMock.ExpectRollback()
 
-		err := repo.Withdraw(context.Background(), walletID, amount)
+		_, err := repo.Withdraw(context.Background(), walletID, amount)
 
 		assert.Error(t, err)
 		assert.Equal(t, "db error", err.Error())
@@ -190,58 +349,1414 @@ func TestWalletRepo_CreateWallet(t *testing.T) {
 	db, sqlMock, _ := sqlmock.New()
 	defer db.Close()
 
-	mockRedis, redisMock := redismock.NewClientMock()
 	logger := logger.NewMockLogger()
 
-	repo := NewWalletRepository(sqlx.NewDb(db, "postgres"), logger, mockRedis)
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger)
 
 	t.Run("Success", func(t *testing.T) {
 		walletID := uuid.New()
-		cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
 
-		sqlMock.ExpectQuery("INSERT INTO wallets \\(wallet_id, amount\\) VALUES \\(\\$1, 0\\) RETURNING wallet_id").
+		sqlMock.ExpectQuery("INSERT INTO wallets \\(wallet_id, amount, currency, owner_id, label, metadata\\)\\s+VALUES \\(\\$1, 0, \\$2, \\$3, \\$4, \\$5\\) ON CONFLICT \\(wallet_id\\) DO NOTHING RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
+			WithArgs(walletID, "RUB", "user-1", "savings", models.Metadata(`{"tier":"gold"}`)).
+			WillReturnRows(sqlmock.NewRows(walletCols).
+				AddRow(walletID, 0, "RUB", 1, models.WalletStatusActive, "user-1", "savings", []byte(`{"tier":"gold"}`), 0, walletTime, walletTime))
+
+		created, err := repo.CreateWallet(context.Background(), &models.Wallet{
+			WalletID: walletID,
+			Currency: "RUB",
+			OwnerID:  "user-1",
+			Label:    "savings",
+			Metadata: models.Metadata(`{"tier":"gold"}`),
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, walletID, created.WalletID)
+		assert.Equal(t, "RUB", created.Currency)
+		assert.Equal(t, "user-1", created.OwnerID)
+		assert.Equal(t, "savings", created.Label)
+		assert.JSONEq(t, `{"tier":"gold"}`, string(created.Metadata))
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Already Exists", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectQuery("INSERT INTO wallets (.+) ON CONFLICT \\(wallet_id\\) DO NOTHING").
+			WithArgs(walletID, "RUB", "", "", models.Metadata(nil)).
+			WillReturnRows(sqlmock.NewRows(walletCols))
+		sqlMock.ExpectQuery("SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = \\$1").
 			WithArgs(walletID).
-			WillReturnRows(sqlmock.NewRows([]string{"wallet_id"}).AddRow(walletID))
+			WillReturnRows(walletRows(walletID, 500))
+
+		existing, err := repo.CreateWallet(context.Background(), &models.Wallet{WalletID: walletID, Currency: "RUB"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, walletID, existing.WalletID)
+		assert.Equal(t, int64(500), existing.Amount)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("DB Failure", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectQuery("INSERT INTO wallets").
+			WithArgs(walletID, "RUB", "", "", models.Metadata(nil)).
+			WillReturnError(errors.New("db error"))
+
+		created, err := repo.CreateWallet(context.Background(), &models.Wallet{WalletID: walletID, Currency: "RUB"})
+
+		assert.Error(t, err)
+		assert.Nil(t, created)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_ListWallets(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	logger := logger.NewMockLogger()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger)
+
+	t.Run("Success", func(t *testing.T) {
+		first, second := uuid.New(), uuid.New()
+
+		sqlMock.ExpectQuery("SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE owner_id = \\$1 ORDER BY wallet_id").
+			WithArgs("user-1").
+			WillReturnRows(sqlmock.NewRows(walletCols).
+				AddRow(first, 100, "RUB", 1, models.WalletStatusActive, "user-1", "main", []byte("{}"), 0, walletTime, walletTime).
+				AddRow(second, 0, "USD", 1, models.WalletStatusFrozen, "user-1", "", []byte("{}"), 0, walletTime, walletTime))
+
+		wallets, err := repo.ListWallets(context.Background(), "user-1")
+
+		assert.NoError(t, err)
+		assert.Len(t, wallets, 2)
+		assert.Equal(t, first, wallets[0].WalletID)
+		assert.Equal(t, "main", wallets[0].Label)
+		assert.Equal(t, models.WalletStatusFrozen, wallets[1].Status)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("DB Failure", func(t *testing.T) {
+		sqlMock.ExpectQuery("SELECT (.+) FROM wallets WHERE owner_id").
+			WithArgs("user-1").
+			WillReturnError(errors.New("db error"))
+
+		wallets, err := repo.ListWallets(context.Background(), "user-1")
 
-		redisMock.ExpectSet(cacheKey, 0, 10*time.Minute).SetVal("OK")
+		assert.Error(t, err)
+		assert.Nil(t, wallets)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_GetTransactions(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	logger := logger.NewMockLogger()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger)
+
+	columns := []string{"id", "wallet_id", "type", "amount", "balance_after", "counterparty_id", "created_at"}
+
+	t.Run("Success", func(t *testing.T) {
+		walletID := uuid.New()
+		createdAt := time.Now()
+
+		sqlMock.ExpectQuery("SELECT id, wallet_id, type, amount, balance_after, counterparty_id, reversal_of, created_at FROM wallet_transactions "+
+			"WHERE wallet_id = \\$1 ORDER BY created_at DESC, id DESC LIMIT \\$2").
+			WithArgs(walletID, 10).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(uuid.New(), walletID, models.TransactionTypeWithdraw, 50, 150, nil, createdAt).
+				AddRow(uuid.New(), walletID, models.TransactionTypeDeposit, 200, 200, nil, createdAt))
+
+		transactions, err := repo.GetTransactions(context.Background(), walletID, models.TransactionFilter{Limit: 10})
 
-		id, err := repo.CreateWallet(context.Background(), walletID)
+		assert.NoError(t, err)
+		assert.Len(t, transactions, 2)
+		assert.Equal(t, int64(150), transactions[0].BalanceAfter)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("With Filters And Cursor", func(t *testing.T) {
+		walletID := uuid.New()
+		from := time.Now().Add(-24 * time.Hour)
+		to := time.Now()
+		cursor := &models.TransactionCursor{CreatedAt: time.Now().Add(-time.Hour), ID: uuid.New()}
+
+		sqlMock.ExpectQuery("FROM wallet_transactions WHERE wallet_id = \\$1 AND type = \\$2 AND created_at >= \\$3 "+
+			"AND created_at < \\$4 AND \\(created_at, id\\) > \\(\\$5, \\$6\\) ORDER BY created_at ASC, id ASC LIMIT \\$7").
+			WithArgs(walletID, models.TransactionTypeDeposit, from, to, cursor.CreatedAt, cursor.ID, 5).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		transactions, err := repo.GetTransactions(context.Background(), walletID, models.TransactionFilter{
+			Type:      models.TransactionTypeDeposit,
+			From:      &from,
+			To:        &to,
+			After:     cursor,
+			Limit:     5,
+			Ascending: true,
+		})
 
 		assert.NoError(t, err)
-		assert.Equal(t, walletID, id)
+		assert.Empty(t, transactions)
 		assert.Nil(t, sqlMock.ExpectationsWereMet())
-		assert.Nil(t, redisMock.ExpectationsWereMet())
 	})
 
 	t.Run("DB Failure", func(t *testing.T) {
 		walletID := uuid.New()
 
-		sqlMock.ExpectQuery("INSERT INTO wallets \\(wallet_id, amount\\) VALUES \\(\\$1, 0\\) RETURNING wallet_id").
-			WithArgs(walletID).
+		sqlMock.ExpectQuery("SELECT id, wallet_id, type, amount, balance_after, counterparty_id, reversal_of, created_at FROM wallet_transactions").
+			WithArgs(walletID, 10).
 			WillReturnError(errors.New("db error"))
 
-		id, err := repo.CreateWallet(context.Background(), walletID)
+		transactions, err := repo.GetTransactions(context.Background(), walletID, models.TransactionFilter{Limit: 10})
 
 		assert.Error(t, err)
-		assert.Equal(t, uuid.UUID{}, id)
+		assert.Nil(t, transactions)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_ReserveIdempotencyKey(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	logger := logger.NewMockLogger()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger)
+
+	t.Run("New Key", func(t *testing.T) {
+		sqlMock.ExpectExec("INSERT INTO idempotency_keys \\(key, request_hash\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(key\\) DO NOTHING").
+			WithArgs("key-1", "hash").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		record, err := repo.ReserveIdempotencyKey(context.Background(), "key-1", "hash")
+
+		assert.NoError(t, err)
+		assert.Nil(t, record)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Existing Key", func(t *testing.T) {
+		sqlMock.ExpectExec("INSERT INTO idempotency_keys").
+			WithArgs("key-1", "hash").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		sqlMock.ExpectQuery("SELECT key, request_hash, status_code, response, created_at FROM idempotency_keys WHERE key = \\$1").
+			WithArgs("key-1").
+			WillReturnRows(sqlmock.NewRows([]string{"key", "request_hash", "status_code", "response", "created_at"}).
+				AddRow("key-1", "hash", 200, []byte(`{}`), time.Now()))
+
+		record, err := repo.ReserveIdempotencyKey(context.Background(), "key-1", "hash")
+
+		assert.NoError(t, err)
+		assert.Equal(t, 200, record.StatusCode)
+		assert.Equal(t, []byte(`{}`), record.Response)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Stale Reservation Taken Over", func(t *testing.T) {
+		repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{IdempotencyInProgressTimeout: time.Minute}, logger)
+
+		// Брошенный резерв того же запроса перехватывается: строка обновлена, ключ свободен для выполнения
+		sqlMock.ExpectExec("ON CONFLICT \\(key\\) DO UPDATE SET created_at = now\\(\\) WHERE idempotency_keys.status_code = 0 "+
+			"AND idempotency_keys.request_hash = EXCLUDED.request_hash AND idempotency_keys.created_at < now\\(\\) - \\$3").
+			WithArgs("key-2", "hash", int64(60000)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		record, err := repo.ReserveIdempotencyKey(context.Background(), "key-2", "hash")
+
+		assert.NoError(t, err)
+		assert.Nil(t, record)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_Transfer(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	logger := logger.NewMockLogger()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger)
+
+	lockQuery := "SELECT wallet_id, amount, held, currency, status FROM wallets WHERE wallet_id IN \\(\\$1, \\$2\\) ORDER BY wallet_id FOR UPDATE"
+
+	t.Run("Success", func(t *testing.T) {
+		fromID, toID := uuid.New(), uuid.New()
+		amount := int64(40)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).
+			WithArgs(fromID, toID).
+			WillReturnRows(sqlmock.NewRows([]string{"wallet_id", "amount", "currency", "status"}).AddRow(fromID, 100, "RUB", models.WalletStatusActive).AddRow(toID, 10, "RUB", models.WalletStatusActive))
+		expectNoLimits(sqlMock, fromID)
+		expectNoLimits(sqlMock, toID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
+			WithArgs(amount, fromID).
+			WillReturnRows(walletRows(fromID, 60))
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata").
+			WithArgs(amount, toID).
+			WillReturnRows(walletRows(toID, 50))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), fromID, models.TransactionTypeTransferOut, amount, int64(60), &toID, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), toID, models.TransactionTypeTransferIn, amount, int64(50), &fromID, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.OperationTypeTransfer)
+		sqlMock.ExpectCommit()
+
+		transaction, err := repo.Transfer(context.Background(), fromID, toID, amount)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.TransactionTypeTransferOut, transaction.Type)
+		assert.Equal(t, toID, *transaction.CounterpartyID)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Insufficient Funds", func(t *testing.T) {
+		fromID, toID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).
+			WithArgs(fromID, toID).
+			WillReturnRows(sqlmock.NewRows([]string{"wallet_id", "amount", "currency", "status"}).AddRow(fromID, 10, "RUB", models.WalletStatusActive).AddRow(toID, 10, "RUB", models.WalletStatusActive))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Transfer(context.Background(), fromID, toID, 40)
+
+		assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Currency Mismatch", func(t *testing.T) {
+		fromID, toID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).
+			WithArgs(fromID, toID).
+			WillReturnRows(sqlmock.NewRows([]string{"wallet_id", "amount", "currency", "status"}).AddRow(fromID, 100, "RUB", models.WalletStatusActive).AddRow(toID, 10, "USD", models.WalletStatusActive))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Transfer(context.Background(), fromID, toID, 40)
+
+		assert.ErrorIs(t, err, wallet.ErrCurrencyMismatch)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Wallet Not Found", func(t *testing.T) {
+		fromID, toID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).
+			WithArgs(fromID, toID).
+			WillReturnRows(sqlmock.NewRows([]string{"wallet_id", "amount", "currency", "status"}).AddRow(fromID, 100, "RUB", models.WalletStatusActive))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Transfer(context.Background(), fromID, toID, 40)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
 		assert.Nil(t, sqlMock.ExpectationsWereMet())
 	})
+}
+
+func TestWalletRepo_Limits(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	// Лимиты по умолчанию: не больше 1000 за операцию, остальное без ограничений
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{MaxOperationAmount: 1000}, logger.NewMockLogger())
 
-	t.Run("Redis Failure", func(t *testing.T) {
+	t.Run("Deposit Over Default Operation Limit", func(t *testing.T) {
 		walletID := uuid.New()
-		cacheKey := fmt.Sprintf("wallet_balance:%s", walletID)
 
-		sqlMock.ExpectQuery("INSERT INTO wallets \\(wallet_id, amount\\) VALUES \\(\\$1, 0\\) RETURNING wallet_id").
-			WithArgs(walletID).
-			WillReturnRows(sqlmock.NewRows([]string{"wallet_id"}).AddRow(walletID))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 0))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Deposit(context.Background(), walletID, 1001)
+
+		assert.ErrorIs(t, err, wallet.ErrOperationLimitExceeded)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
 
-		redisMock.ExpectSet(cacheKey, 0, 10*time.Minute).SetErr(errors.New("redis error"))
+	t.Run("Wallet Limit Overrides Default", func(t *testing.T) {
+		walletID := uuid.New()
+		amount := int64(5000)
+
+		// У кошелька лимит на операцию снят нулем
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 0))
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnRows(limitRows(walletID, int64Ptr(0), nil, nil, nil))
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1").
+			WithArgs(amount, walletID).
+			WillReturnRows(walletRows(walletID, amount))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeDeposit)
+		sqlMock.ExpectCommit()
 
-		id, err := repo.CreateWallet(context.Background(), walletID)
+		_, err := repo.Deposit(context.Background(), walletID, amount)
 
 		assert.NoError(t, err)
-		assert.Equal(t, walletID, id)
 		assert.Nil(t, sqlMock.ExpectationsWereMet())
-		assert.Nil(t, redisMock.ExpectationsWereMet())
+	})
+
+	t.Run("Deposit Over Max Balance", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 900))
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnRows(limitRows(walletID, nil, int64Ptr(1000), nil, nil))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Deposit(context.Background(), walletID, 101)
+
+		assert.ErrorIs(t, err, wallet.ErrBalanceLimitExceeded)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Deposit Balance Overflow", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, math.MaxInt64-10))
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnRows(limitRows(walletID, int64Ptr(0), nil, nil, nil))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Deposit(context.Background(), walletID, 11)
+
+		assert.ErrorIs(t, err, wallet.ErrBalanceOverflow)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Withdraw Over Daily Limit", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 900))
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnRows(limitRows(walletID, nil, nil, int64Ptr(500), nil))
+		sqlMock.ExpectQuery(totalsQuery).
+			WithArgs(walletID, models.TransactionTypeWithdraw, models.TransactionTypeTransferOut, models.TransactionTypeCapture).
+			WillReturnRows(sqlmock.NewRows([]string{"daily", "monthly"}).AddRow(400, 400))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Withdraw(context.Background(), walletID, 200)
+
+		assert.ErrorIs(t, err, wallet.ErrDailyWithdrawalLimitExceeded)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Withdraw Over Monthly Limit", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 900))
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnRows(limitRows(walletID, nil, nil, int64Ptr(500), int64Ptr(3000)))
+		sqlMock.ExpectQuery(totalsQuery).
+			WithArgs(walletID, models.TransactionTypeWithdraw, models.TransactionTypeTransferOut, models.TransactionTypeCapture).
+			WillReturnRows(sqlmock.NewRows([]string{"daily", "monthly"}).AddRow(0, 2900))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Withdraw(context.Background(), walletID, 200)
+
+		assert.ErrorIs(t, err, wallet.ErrMonthlyWithdrawalLimitExceeded)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Transfer Over Recipient Max Balance", func(t *testing.T) {
+		fromID, toID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery("SELECT wallet_id, amount, held, currency, status FROM wallets WHERE wallet_id IN").
+			WithArgs(fromID, toID).
+			WillReturnRows(sqlmock.NewRows([]string{"wallet_id", "amount", "currency", "status"}).
+				AddRow(fromID, 500, "RUB", models.WalletStatusActive).
+				AddRow(toID, 950, "RUB", models.WalletStatusActive))
+		expectNoLimits(sqlMock, fromID)
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(toID).WillReturnRows(limitRows(toID, nil, int64Ptr(1000), nil, nil))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Transfer(context.Background(), fromID, toID, 100)
+
+		assert.ErrorIs(t, err, wallet.ErrBalanceLimitExceeded)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_GetLimits(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{MaxOperationAmount: 1000, DailyWithdrawalLimit: 5000}, logger.NewMockLogger())
+	query := "SELECT w.wallet_id, l.max_operation_amount, l.max_balance, l.daily_withdrawal_limit, l.monthly_withdrawal_limit " +
+		"FROM wallets w LEFT JOIN wallet_limits l ON l.wallet_id = w.wallet_id WHERE w.wallet_id = \\$1"
+
+	t.Run("Merged With Defaults", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectQuery(query).
+			WithArgs(walletID).
+			WillReturnRows(limitRows(walletID, nil, int64Ptr(100000), int64Ptr(0), nil))
+
+		limits, err := repo.GetLimits(context.Background(), walletID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1000), *limits.MaxOperationAmount)
+		assert.Equal(t, int64(100000), *limits.MaxBalance)
+		assert.Equal(t, int64(0), *limits.DailyWithdrawalLimit)
+		assert.Equal(t, int64(0), *limits.MonthlyWithdrawalLimit)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Wallet Not Found", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectQuery(query).WithArgs(walletID).WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.GetLimits(context.Background(), walletID)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_SetLimits(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+
+	t.Run("Success", func(t *testing.T) {
+		walletID := uuid.New()
+		maxBalance := int64Ptr(100000)
+
+		sqlMock.ExpectExec("INSERT INTO wallet_limits (.+) WHERE EXISTS \\(SELECT 1 FROM wallets WHERE wallet_id = \\$1\\) ON CONFLICT \\(wallet_id\\) DO UPDATE").
+			WithArgs(walletID, nil, maxBalance, nil, nil).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectQuery("FROM wallets w LEFT JOIN wallet_limits l").
+			WithArgs(walletID).
+			WillReturnRows(limitRows(walletID, nil, maxBalance, nil, nil))
+
+		limits, err := repo.SetLimits(context.Background(), &models.WalletLimits{WalletID: walletID, MaxBalance: maxBalance})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(100000), *limits.MaxBalance)
+		assert.Equal(t, int64(0), *limits.MaxOperationAmount)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Wallet Not Found", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectExec("INSERT INTO wallet_limits").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		_, err := repo.SetLimits(context.Background(), &models.WalletLimits{WalletID: walletID})
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_WithdrawInactive(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+	walletID := uuid.New()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery("SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = \\$1 FOR UPDATE").
+		WithArgs(walletID).
+		WillReturnRows(statusRows(walletID, 200, models.WalletStatusFrozen))
+	sqlMock.ExpectRollback()
+
+	_, err := repo.Withdraw(context.Background(), walletID, 100)
+
+	assert.ErrorIs(t, err, wallet.ErrWalletFrozen)
+	assert.Nil(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestWalletRepo_TransferInactive(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+	fromID, toID := uuid.New(), uuid.New()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery("SELECT wallet_id, amount, held, currency, status FROM wallets WHERE wallet_id IN \\(\\$1, \\$2\\) ORDER BY wallet_id FOR UPDATE").
+		WithArgs(fromID, toID).
+		WillReturnRows(sqlmock.NewRows([]string{"wallet_id", "amount", "currency", "status"}).
+			AddRow(fromID, 100, "RUB", models.WalletStatusActive).
+			AddRow(toID, 10, "RUB", models.WalletStatusClosed))
+	sqlMock.ExpectRollback()
+
+	_, err := repo.Transfer(context.Background(), fromID, toID, 40)
+
+	assert.ErrorIs(t, err, wallet.ErrWalletClosed)
+	assert.Nil(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestWalletRepo_UpdateStatus(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+
+	lockQuery := "SELECT wallet_id, amount, currency, version, status, owner_id, label, metadata, held, created_at, updated_at FROM wallets WHERE wallet_id = \\$1 FOR UPDATE"
+	updateQuery := "UPDATE wallets SET status = \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING wallet_id, amount, currency, version, status, owner_id, label, metadata"
+
+	t.Run("Freeze", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).WithArgs(walletID).
+			WillReturnRows(statusRows(walletID, 100, models.WalletStatusActive))
+		sqlMock.ExpectQuery(updateQuery).WithArgs(models.WalletStatusFrozen, walletID).
+			WillReturnRows(statusRows(walletID, 100, models.WalletStatusFrozen))
+		sqlMock.ExpectCommit()
+
+		w, err := repo.UpdateStatus(context.Background(), walletID, models.WalletStatusFrozen)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.WalletStatusFrozen, w.Status)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Same Status Is No-op", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).WithArgs(walletID).
+			WillReturnRows(statusRows(walletID, 100, models.WalletStatusFrozen))
+		sqlMock.ExpectRollback()
+
+		w, err := repo.UpdateStatus(context.Background(), walletID, models.WalletStatusFrozen)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.WalletStatusFrozen, w.Status)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Close With Balance", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).WithArgs(walletID).
+			WillReturnRows(statusRows(walletID, 100, models.WalletStatusActive))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.UpdateStatus(context.Background(), walletID, models.WalletStatusClosed)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotEmpty)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Close Empty Frozen Wallet", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).WithArgs(walletID).
+			WillReturnRows(statusRows(walletID, 0, models.WalletStatusFrozen))
+		sqlMock.ExpectQuery(updateQuery).WithArgs(models.WalletStatusClosed, walletID).
+			WillReturnRows(statusRows(walletID, 0, models.WalletStatusClosed))
+		sqlMock.ExpectCommit()
+
+		w, err := repo.UpdateStatus(context.Background(), walletID, models.WalletStatusClosed)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.WalletStatusClosed, w.Status)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Reopen Closed Wallet", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).WithArgs(walletID).
+			WillReturnRows(statusRows(walletID, 0, models.WalletStatusClosed))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.UpdateStatus(context.Background(), walletID, models.WalletStatusActive)
+
+		assert.ErrorIs(t, err, wallet.ErrInvalidStatusTransition)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Wallet Not Found", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockQuery).WithArgs(walletID).WillReturnError(sql.ErrNoRows)
+		sqlMock.ExpectRollback()
+
+		_, err := repo.UpdateStatus(context.Background(), walletID, models.WalletStatusFrozen)
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+// holdRows строка холда с остатком amount
+func holdRows(holdID, walletID uuid.UUID, amount int64, status string, expiresAt time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "wallet_id", "amount", "captured", "status", "expires_at", "created_at"}).
+		AddRow(holdID, walletID, amount, 0, status, expiresAt, time.Now())
+}
+
+const lockHoldQuery = "SELECT id, wallet_id, amount, captured, status, expires_at, created_at FROM wallet_holds WHERE id = \\$1 AND wallet_id = \\$2 FOR UPDATE"
+
+func TestWalletRepo_ExpectedVersion(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+
+	t.Run("Deposit Version Matches", func(t *testing.T) {
+		walletID := uuid.New()
+		ctx := wallet.WithExpectedVersion(context.Background(), 1)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 AND version = \\$3 RETURNING").
+			WithArgs(int64(50), walletID, int64(1)).
+			WillReturnRows(walletRows(walletID, 150))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), walletID, models.TransactionTypeDeposit, int64(50), int64(150), nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeDeposit)
+		sqlMock.ExpectCommit()
+
+		transaction, err := repo.Deposit(ctx, walletID, 50)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(150), transaction.BalanceAfter)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Withdraw Version Changed", func(t *testing.T) {
+		walletID := uuid.New()
+		ctx := wallet.WithExpectedVersion(context.Background(), 7)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1, .* WHERE wallet_id = \\$2 AND version = \\$3 RETURNING").
+			WithArgs(int64(50), walletID, int64(7)).
+			WillReturnError(sql.ErrNoRows)
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Withdraw(ctx, walletID, 50)
+
+		assert.ErrorIs(t, err, wallet.ErrVersionMismatch)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CreateHold Version Changed", func(t *testing.T) {
+		walletID := uuid.New()
+		ctx := wallet.WithExpectedVersion(context.Background(), 7)
+		expiresAt := time.Now().Add(time.Hour)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("INSERT INTO wallet_holds").
+			WillReturnRows(holdRows(uuid.New(), walletID, 50, models.HoldStatusActive, expiresAt))
+		sqlMock.ExpectExec("UPDATE wallets SET held = held \\+ \\$1, .* WHERE wallet_id = \\$2 AND version = \\$3").
+			WithArgs(int64(50), walletID, int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.CreateHold(ctx, walletID, 50, expiresAt)
+
+		assert.ErrorIs(t, err, wallet.ErrVersionMismatch)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_Holds(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+	expiresAt := time.Now().Add(time.Hour)
+
+	t.Run("Withdraw Held Funds", func(t *testing.T) {
+		walletID := uuid.New()
+
+		// Проведенного баланса хватает, но 150 из 200 зарезервировано
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 150))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Withdraw(context.Background(), walletID, 100)
+
+		assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CreateHold Success", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 50))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("INSERT INTO wallet_holds \\(id, wallet_id, amount, expires_at\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\) RETURNING id, wallet_id, amount, captured, status, expires_at, created_at").
+			WithArgs(sqlmock.AnyArg(), walletID, int64(150), expiresAt).
+			WillReturnRows(holdRows(holdID, walletID, 150, models.HoldStatusActive, expiresAt))
+		sqlMock.ExpectExec("UPDATE wallets SET held = held \\+ \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2").
+			WithArgs(int64(150), walletID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		hold, err := repo.CreateHold(context.Background(), walletID, 150, expiresAt)
+
+		assert.NoError(t, err)
+		assert.Equal(t, holdID, hold.ID)
+		assert.Equal(t, int64(150), hold.Amount)
+		assert.Equal(t, models.HoldStatusActive, hold.Status)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CreateHold Holds Exceed Daily Limit", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		// Первый холд на весь дневной лимит проходит
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 300, 0))
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnRows(limitRows(walletID, nil, nil, int64Ptr(100), nil))
+		sqlMock.ExpectQuery(totalsQuery).
+			WithArgs(walletID, models.TransactionTypeWithdraw, models.TransactionTypeTransferOut, models.TransactionTypeCapture).
+			WillReturnRows(sqlmock.NewRows([]string{"daily", "monthly"}).AddRow(0, 0))
+		sqlMock.ExpectQuery("INSERT INTO wallet_holds").
+			WillReturnRows(holdRows(holdID, walletID, 100, models.HoldStatusActive, expiresAt))
+		sqlMock.ExpectExec("UPDATE wallets SET held = held \\+ \\$1").
+			WithArgs(int64(100), walletID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		_, err := repo.CreateHold(context.Background(), walletID, 100, expiresAt)
+		assert.NoError(t, err)
+
+		// Второй холд: в журнале списаний еще нет, но первый холд уже занял лимит
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 300, 100))
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnRows(limitRows(walletID, nil, nil, int64Ptr(100), nil))
+		sqlMock.ExpectQuery(totalsQuery).
+			WithArgs(walletID, models.TransactionTypeWithdraw, models.TransactionTypeTransferOut, models.TransactionTypeCapture).
+			WillReturnRows(sqlmock.NewRows([]string{"daily", "monthly"}).AddRow(0, 0))
+		sqlMock.ExpectRollback()
+
+		_, err = repo.CreateHold(context.Background(), walletID, 100, expiresAt)
+
+		assert.ErrorIs(t, err, wallet.ErrDailyWithdrawalLimitExceeded)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Withdraw Counts Active Holds", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 1000, 300))
+		sqlMock.ExpectQuery(limitsQuery).WithArgs(walletID).WillReturnRows(limitRows(walletID, nil, nil, nil, int64Ptr(500)))
+		sqlMock.ExpectQuery(totalsQuery).
+			WithArgs(walletID, models.TransactionTypeWithdraw, models.TransactionTypeTransferOut, models.TransactionTypeCapture).
+			WillReturnRows(sqlmock.NewRows([]string{"daily", "monthly"}).AddRow(0, 100))
+		sqlMock.ExpectRollback()
+
+		// 100 списано за месяц, 300 в холдах: еще 200 превышают месячный лимит
+		_, err := repo.Withdraw(context.Background(), walletID, 200)
+
+		assert.ErrorIs(t, err, wallet.ErrMonthlyWithdrawalLimitExceeded)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CreateHold Insufficient Available", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 150))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.CreateHold(context.Background(), walletID, 100, expiresAt)
+
+		assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CaptureHold Partial", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 100))
+		sqlMock.ExpectQuery(lockHoldQuery).WithArgs(holdID, walletID).
+			WillReturnRows(holdRows(holdID, walletID, 100, models.HoldStatusActive, expiresAt))
+		// Остаток холда 60, он остается активным
+		sqlMock.ExpectExec("UPDATE wallet_holds SET amount = amount - \\$1, captured = captured \\+ \\$1, status = \\$2 WHERE id = \\$3").
+			WithArgs(int64(40), models.HoldStatusActive, holdID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1, held = held - \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING").
+			WithArgs(int64(40), walletID).
+			WillReturnRows(heldRows(walletID, 160, 60))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), walletID, models.TransactionTypeCapture, int64(40), int64(160), nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeCapture)
+		sqlMock.ExpectCommit()
+
+		transaction, err := repo.CaptureHold(context.Background(), walletID, holdID, 40)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.TransactionTypeCapture, transaction.Type)
+		assert.Equal(t, int64(160), transaction.BalanceAfter)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CaptureHold Full", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 100))
+		sqlMock.ExpectQuery(lockHoldQuery).WithArgs(holdID, walletID).
+			WillReturnRows(holdRows(holdID, walletID, 100, models.HoldStatusActive, expiresAt))
+		sqlMock.ExpectExec("UPDATE wallet_holds SET").
+			WithArgs(int64(100), models.HoldStatusCaptured, holdID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1, held = held - \\$1").
+			WithArgs(int64(100), walletID).
+			WillReturnRows(heldRows(walletID, 100, 0))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), walletID, models.TransactionTypeCapture, int64(100), int64(100), nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeCapture)
+		sqlMock.ExpectCommit()
+
+		_, err := repo.CaptureHold(context.Background(), walletID, holdID, 100)
+
+		assert.NoError(t, err)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CaptureHold Exceeds Hold", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 100))
+		sqlMock.ExpectQuery(lockHoldQuery).WithArgs(holdID, walletID).
+			WillReturnRows(holdRows(holdID, walletID, 100, models.HoldStatusActive, expiresAt))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.CaptureHold(context.Background(), walletID, holdID, 150)
+
+		assert.ErrorIs(t, err, wallet.ErrCaptureExceedsHold)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CaptureHold Expired", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		// Срок вышел, но фоновая очистка до холда еще не дошла
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 100))
+		sqlMock.ExpectQuery(lockHoldQuery).WithArgs(holdID, walletID).
+			WillReturnRows(holdRows(holdID, walletID, 100, models.HoldStatusActive, time.Now().Add(-time.Minute)))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.CaptureHold(context.Background(), walletID, holdID, 50)
+
+		assert.ErrorIs(t, err, wallet.ErrHoldNotActive)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CaptureHold Not Found", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 0))
+		sqlMock.ExpectQuery(lockHoldQuery).WithArgs(holdID, walletID).WillReturnError(sql.ErrNoRows)
+		sqlMock.ExpectRollback()
+
+		_, err := repo.CaptureHold(context.Background(), walletID, holdID, 50)
+
+		assert.ErrorIs(t, err, wallet.ErrHoldNotFound)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("ReleaseHold Success", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 70))
+		sqlMock.ExpectQuery(lockHoldQuery).WithArgs(holdID, walletID).
+			WillReturnRows(holdRows(holdID, walletID, 70, models.HoldStatusActive, expiresAt))
+		sqlMock.ExpectQuery("UPDATE wallet_holds SET status = \\$1 WHERE id = \\$2 RETURNING").
+			WithArgs(models.HoldStatusReleased, holdID).
+			WillReturnRows(holdRows(holdID, walletID, 70, models.HoldStatusReleased, expiresAt))
+		sqlMock.ExpectExec("UPDATE wallets SET held = held - \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2").
+			WithArgs(int64(70), walletID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		hold, err := repo.ReleaseHold(context.Background(), walletID, holdID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.HoldStatusReleased, hold.Status)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("ReleaseHold Already Captured", func(t *testing.T) {
+		walletID, holdID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 200, 0))
+		sqlMock.ExpectQuery(lockHoldQuery).WithArgs(holdID, walletID).
+			WillReturnRows(holdRows(holdID, walletID, 0, models.HoldStatusCaptured, expiresAt))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.ReleaseHold(context.Background(), walletID, holdID)
+
+		assert.ErrorIs(t, err, wallet.ErrHoldNotActive)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("ExpireHolds", func(t *testing.T) {
+		expiredID, racedID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectQuery("SELECT DISTINCT wallet_id FROM wallet_holds WHERE status = \\$1 AND expires_at <= now\\(\\) LIMIT \\$2").
+			WithArgs(models.HoldStatusActive, 10).
+			WillReturnRows(sqlmock.NewRows([]string{"wallet_id"}).AddRow(expiredID).AddRow(racedID))
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(expiredID).WillReturnRows(heldRows(expiredID, 200, 50))
+		sqlMock.ExpectQuery("UPDATE wallet_holds SET status = \\$1 WHERE wallet_id = \\$2 AND status = \\$3 AND expires_at <= now\\(\\) RETURNING amount").
+			WithArgs(models.HoldStatusExpired, expiredID, models.HoldStatusActive).
+			WillReturnRows(sqlmock.NewRows([]string{"amount"}).AddRow(30).AddRow(20))
+		sqlMock.ExpectExec("UPDATE wallets SET held = held - \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2").
+			WithArgs(int64(50), expiredID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		// Холд второго кошелька успели списать, пока ждали блокировку
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(racedID).WillReturnRows(heldRows(racedID, 200, 0))
+		sqlMock.ExpectQuery("UPDATE wallet_holds SET status").
+			WithArgs(models.HoldStatusExpired, racedID, models.HoldStatusActive).
+			WillReturnRows(sqlmock.NewRows([]string{"amount"}))
+		sqlMock.ExpectRollback()
+
+		walletIDs, err := repo.ExpireHolds(context.Background(), 10)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{expiredID}, walletIDs)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+const (
+	originalQuery = "SELECT id, wallet_id, type, amount, balance_after, counterparty_id, reversal_of, created_at FROM wallet_transactions WHERE id = \\$1 AND wallet_id = \\$2"
+	reversedQuery = "SELECT COALESCE\\(SUM\\(amount\\), 0\\) FROM wallet_transactions WHERE reversal_of = \\$1"
+)
+
+// originalRows исходная операция для сторно
+func originalRows(transactionID, walletID uuid.UUID, transactionType string, amount int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "wallet_id", "type", "amount", "balance_after", "counterparty_id", "reversal_of", "created_at"}).
+		AddRow(transactionID, walletID, transactionType, amount, amount, nil, nil, time.Now())
+}
+
+func TestWalletRepo_Reverse(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+
+	t.Run("Partial Refund Of Withdraw", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 200))
+		sqlMock.ExpectQuery(originalQuery).WithArgs(originalID, walletID).
+			WillReturnRows(originalRows(originalID, walletID, models.TransactionTypeWithdraw, 100))
+		// 30 из 100 уже вернули предыдущим сторно
+		sqlMock.ExpectQuery(reversedQuery).WithArgs(originalID).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(30))
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING").
+			WithArgs(int64(50), walletID).
+			WillReturnRows(walletRows(walletID, 250))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), walletID, models.TransactionTypeReversal, int64(50), int64(250), nil, &originalID).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeReversal)
+		sqlMock.ExpectCommit()
+
+		transaction, err := repo.Reverse(context.Background(), walletID, originalID, 50)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.TransactionTypeReversal, transaction.Type)
+		assert.Equal(t, &originalID, transaction.ReversalOf)
+		assert.Equal(t, int64(250), transaction.BalanceAfter)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Full Reversal Of Deposit", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 200))
+		sqlMock.ExpectQuery(originalQuery).WithArgs(originalID, walletID).
+			WillReturnRows(originalRows(originalID, walletID, models.TransactionTypeDeposit, 100))
+		sqlMock.ExpectQuery(reversedQuery).WithArgs(originalID).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(0))
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1, version = version \\+ 1, updated_at = now\\(\\) WHERE wallet_id = \\$2 RETURNING").
+			WithArgs(int64(100), walletID).
+			WillReturnRows(walletRows(walletID, 100))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WithArgs(sqlmock.AnyArg(), walletID, models.TransactionTypeReversal, int64(100), int64(100), nil, &originalID).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		expectLedgerEntry(sqlMock, models.TransactionTypeReversal)
+		sqlMock.ExpectCommit()
+
+		_, err := repo.Reverse(context.Background(), walletID, originalID, 100)
+
+		assert.NoError(t, err)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Deposit Already Spent", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+
+		// Пополнение на 100, но доступно только 60: остальное зарезервировано
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(heldRows(walletID, 100, 40))
+		sqlMock.ExpectQuery(originalQuery).WithArgs(originalID, walletID).
+			WillReturnRows(originalRows(originalID, walletID, models.TransactionTypeDeposit, 100))
+		sqlMock.ExpectQuery(reversedQuery).WithArgs(originalID).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(0))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Reverse(context.Background(), walletID, originalID, 100)
+
+		assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Already Reversed", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 200))
+		sqlMock.ExpectQuery(originalQuery).WithArgs(originalID, walletID).
+			WillReturnRows(originalRows(originalID, walletID, models.TransactionTypeWithdraw, 100))
+		sqlMock.ExpectQuery(reversedQuery).WithArgs(originalID).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(100))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Reverse(context.Background(), walletID, originalID, 10)
+
+		assert.ErrorIs(t, err, wallet.ErrAlreadyReversed)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Exceeds Remaining", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 200))
+		sqlMock.ExpectQuery(originalQuery).WithArgs(originalID, walletID).
+			WillReturnRows(originalRows(originalID, walletID, models.TransactionTypeCapture, 100))
+		sqlMock.ExpectQuery(reversedQuery).WithArgs(originalID).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(70))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Reverse(context.Background(), walletID, originalID, 50)
+
+		assert.ErrorIs(t, err, wallet.ErrReversalExceedsOriginal)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Transfer Not Reversible", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 200))
+		sqlMock.ExpectQuery(originalQuery).WithArgs(originalID, walletID).
+			WillReturnRows(originalRows(originalID, walletID, models.TransactionTypeTransferOut, 100))
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Reverse(context.Background(), walletID, originalID, 50)
+
+		assert.ErrorIs(t, err, wallet.ErrNotReversible)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Transaction Of Another Wallet", func(t *testing.T) {
+		walletID, originalID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 200))
+		sqlMock.ExpectQuery(originalQuery).WithArgs(originalID, walletID).WillReturnError(sql.ErrNoRows)
+		sqlMock.ExpectRollback()
+
+		_, err := repo.Reverse(context.Background(), walletID, originalID, 50)
+
+		assert.ErrorIs(t, err, wallet.ErrTransactionNotFound)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+var scheduleCols = []string{"id", "wallet_id", "operation_type", "to_wallet_id", "amount", "recurrence", "start_at", "next_run_at", "iteration", "status", "created_at"}
+
+// scheduleRow добавляет строку расписания, ожидающего запуска в startAt
+func scheduleRow(rows *sqlmock.Rows, s models.Schedule) *sqlmock.Rows {
+	return rows.AddRow(s.ID, s.WalletID, s.OperationType, s.ToWalletID, s.Amount, s.Recurrence, s.StartAt, s.NextRunAt, s.Iteration, s.Status, time.Now())
+}
+
+func TestWalletRepo_Ledger(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{FundingAccount: "funding", PayoutAccount: "payout"}, logger.NewMockLogger())
+
+	t.Run("Deposit Debits Funding", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount \\+ \\$1").
+			WithArgs(int64(50), walletID).
+			WillReturnRows(walletRows(walletID, 150))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		sqlMock.ExpectExec("INSERT INTO ledger_entries").
+			WithArgs(sqlmock.AnyArg(), models.TransactionTypeDeposit, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectExec("INSERT INTO ledger_postings \\(entry_id, leg, wallet_id, system_account, amount\\) VALUES \\(\\$1, 1, \\$2, \\$3, \\$4\\), \\(\\$1, 2, \\$5, \\$6, \\$7\\)").
+			WithArgs(sqlmock.AnyArg(), nil, "funding", int64(-50), walletID, nil, int64(50)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		sqlMock.ExpectCommit()
+
+		_, err := repo.Deposit(context.Background(), walletID, 50)
+
+		assert.NoError(t, err)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Withdraw Credits Payout", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(lockWalletQuery).WithArgs(walletID).WillReturnRows(walletRows(walletID, 100))
+		expectNoLimits(sqlMock, walletID)
+		sqlMock.ExpectQuery("UPDATE wallets SET amount = amount - \\$1").
+			WithArgs(int64(30), walletID).
+			WillReturnRows(walletRows(walletID, 70))
+		sqlMock.ExpectQuery("INSERT INTO wallet_transactions").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		sqlMock.ExpectExec("INSERT INTO ledger_entries").
+			WithArgs(sqlmock.AnyArg(), models.TransactionTypeWithdraw, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectExec("INSERT INTO ledger_postings").
+			WithArgs(sqlmock.AnyArg(), walletID, nil, int64(-30), nil, "payout", int64(30)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		sqlMock.ExpectCommit()
+
+		_, err := repo.Withdraw(context.Background(), walletID, 30)
+
+		assert.NoError(t, err)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Check Balanced", func(t *testing.T) {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery("SELECT entry_id FROM ledger_postings GROUP BY entry_id HAVING SUM\\(amount\\) <> 0").
+			WithArgs(ledgerCheckLimit).
+			WillReturnRows(sqlmock.NewRows([]string{"entry_id"}))
+		sqlMock.ExpectQuery("SELECT w.wallet_id FROM wallets w").
+			WithArgs(ledgerCheckLimit).
+			WillReturnRows(sqlmock.NewRows([]string{"wallet_id"}))
+		sqlMock.ExpectQuery("SELECT system_account, SUM\\(amount\\) AS amount FROM ledger_postings").
+			WillReturnRows(sqlmock.NewRows([]string{"system_account", "amount"}).
+				AddRow("funding", int64(-500)).
+				AddRow("payout", int64(200)))
+		sqlMock.ExpectQuery("SELECT COALESCE\\(SUM\\(amount\\), 0\\) FROM ledger_postings").
+			WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(int64(0)))
+		sqlMock.ExpectRollback()
+
+		check, err := repo.CheckLedger(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, check.Balanced)
+		assert.Empty(t, check.UnbalancedEntries)
+		assert.Equal(t, map[string]int64{"funding": -500, "payout": 200}, check.SystemAccounts)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Check Mismatched Wallet", func(t *testing.T) {
+		walletID := uuid.New()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery("SELECT entry_id FROM ledger_postings").
+			WillReturnRows(sqlmock.NewRows([]string{"entry_id"}))
+		sqlMock.ExpectQuery("SELECT w.wallet_id FROM wallets w").
+			WillReturnRows(sqlmock.NewRows([]string{"wallet_id"}).AddRow(walletID))
+		sqlMock.ExpectQuery("SELECT system_account").
+			WillReturnRows(sqlmock.NewRows([]string{"system_account", "amount"}))
+		sqlMock.ExpectQuery("SELECT COALESCE").
+			WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(int64(0)))
+		sqlMock.ExpectRollback()
+
+		check, err := repo.CheckLedger(context.Background())
+
+		// Книга сходится в ноль, но баланс кошелька изменен в обход проводок
+		assert.NoError(t, err)
+		assert.False(t, check.Balanced)
+		assert.Equal(t, []uuid.UUID{walletID}, check.MismatchedWallets)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestWalletRepo_Schedules(t *testing.T) {
+	db, sqlMock, _ := sqlmock.New()
+	defer db.Close()
+
+	repo := NewPgRepository(sqlx.NewDb(db, "postgres"), config.WalletConfig{}, logger.NewMockLogger())
+	runAt := time.Now().Add(time.Hour)
+
+	t.Run("Create", func(t *testing.T) {
+		s := models.Schedule{ID: uuid.New(), WalletID: uuid.New(), OperationType: models.TransactionTypeDeposit, Amount: 100, Recurrence: models.RecurrenceDaily, StartAt: runAt}
+		created := s
+		created.NextRunAt, created.Status = runAt, models.ScheduleStatusActive
+
+		sqlMock.ExpectQuery("INSERT INTO wallet_schedules").
+			WithArgs(s.ID, s.WalletID, s.OperationType, nil, s.Amount, s.Recurrence, runAt, models.ScheduleStatusActive).
+			WillReturnRows(scheduleRow(sqlmock.NewRows(scheduleCols), created))
+
+		result, err := repo.CreateSchedule(context.Background(), &s)
+
+		assert.NoError(t, err)
+		assert.Equal(t, s.ID, result.ID)
+		assert.Equal(t, models.ScheduleStatusActive, result.Status)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Cancel Not Active", func(t *testing.T) {
+		walletID, scheduleID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectQuery("UPDATE wallet_schedules SET status = \\$1 WHERE id = \\$2 AND wallet_id = \\$3 AND status = \\$4 RETURNING").
+			WithArgs(models.ScheduleStatusCancelled, scheduleID, walletID, models.ScheduleStatusActive).
+			WillReturnError(sql.ErrNoRows)
+		sqlMock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM wallet_schedules WHERE id = \\$1 AND wallet_id = \\$2\\)").
+			WithArgs(scheduleID, walletID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		_, err := repo.CancelSchedule(context.Background(), walletID, scheduleID)
+
+		assert.ErrorIs(t, err, wallet.ErrScheduleNotActive)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Cancel Not Found", func(t *testing.T) {
+		walletID, scheduleID := uuid.New(), uuid.New()
+
+		sqlMock.ExpectQuery("UPDATE wallet_schedules SET status").
+			WithArgs(models.ScheduleStatusCancelled, scheduleID, walletID, models.ScheduleStatusActive).
+			WillReturnError(sql.ErrNoRows)
+		sqlMock.ExpectQuery("SELECT EXISTS").
+			WithArgs(scheduleID, walletID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		_, err := repo.CancelSchedule(context.Background(), walletID, scheduleID)
+
+		assert.ErrorIs(t, err, wallet.ErrScheduleNotFound)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Executions", func(t *testing.T) {
+		walletID, scheduleID, transactionID := uuid.New(), uuid.New(), uuid.New()
+
+		sqlMock.ExpectQuery("SELECT EXISTS").
+			WithArgs(scheduleID, walletID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		sqlMock.ExpectQuery("SELECT id, schedule_id, run_at, status, transaction_id, error, started_at, finished_at FROM wallet_schedule_executions WHERE schedule_id = \\$1 ORDER BY run_at DESC, id DESC LIMIT \\$2").
+			WithArgs(scheduleID, 100).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "schedule_id", "run_at", "status", "transaction_id", "error", "started_at", "finished_at"}).
+				AddRow(uuid.New(), scheduleID, runAt, models.ExecutionStatusSucceeded, transactionID, "", runAt, runAt).
+				AddRow(uuid.New(), scheduleID, runAt, models.ExecutionStatusFailed, nil, "insufficient funds", runAt, runAt))
+
+		executions, err := repo.GetScheduleExecutions(context.Background(), walletID, scheduleID, 100)
+
+		assert.NoError(t, err)
+		assert.Len(t, executions, 2)
+		assert.Equal(t, &transactionID, executions[0].TransactionID)
+		assert.Equal(t, "insufficient funds", executions[1].Error)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Claim Due", func(t *testing.T) {
+		// Ежемесячное расписание, реплики которого не работали больше года
+		startAt := time.Date(time.Now().Year()-1, time.January, 31, 9, 0, 0, 0, time.UTC)
+		monthly := models.Schedule{
+			ID: uuid.New(), WalletID: uuid.New(), OperationType: models.TransactionTypeWithdraw, Amount: 100,
+			Recurrence: models.RecurrenceMonthly, StartAt: startAt, NextRunAt: startAt, Status: models.ScheduleStatusActive,
+		}
+		once := models.Schedule{
+			ID: uuid.New(), WalletID: uuid.New(), OperationType: models.TransactionTypeDeposit, Amount: 50,
+			StartAt: time.Now().Add(-time.Minute), NextRunAt: time.Now().Add(-time.Minute), Status: models.ScheduleStatusActive,
+		}
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery("SELECT (.+) FROM wallet_schedules WHERE status = \\$1 AND next_run_at <= now\\(\\) ORDER BY next_run_at LIMIT \\$2 FOR UPDATE SKIP LOCKED").
+			WithArgs(models.ScheduleStatusActive, 10).
+			WillReturnRows(scheduleRow(scheduleRow(sqlmock.NewRows(scheduleCols), monthly), once))
+		// Пропущенные за год запуски не догоняются: расписание переходит сразу на будущий
+		sqlMock.ExpectExec("UPDATE wallet_schedules SET next_run_at = \\$1, iteration = \\$2, status = \\$3 WHERE id = \\$4").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), models.ScheduleStatusActive, monthly.ID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectQuery("INSERT INTO wallet_schedule_executions \\(id, schedule_id, run_at, status\\)").
+			WithArgs(sqlmock.AnyArg(), monthly.ID, startAt, models.ExecutionStatusPending).
+			WillReturnRows(sqlmock.NewRows([]string{"started_at"}).AddRow(time.Now()))
+		sqlMock.ExpectExec("UPDATE wallet_schedules SET next_run_at").
+			WithArgs(once.NextRunAt, 0, models.ScheduleStatusCompleted, once.ID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectQuery("INSERT INTO wallet_schedule_executions").
+			WithArgs(sqlmock.AnyArg(), once.ID, once.NextRunAt, models.ExecutionStatusPending).
+			WillReturnRows(sqlmock.NewRows([]string{"started_at"}).AddRow(time.Now()))
+		sqlMock.ExpectCommit()
+
+		runs, err := repo.ClaimDueSchedules(context.Background(), 10)
+
+		assert.NoError(t, err)
+		assert.Len(t, runs, 2)
+		assert.Equal(t, monthly.ID, runs[0].Schedule.ID)
+		assert.Equal(t, startAt, runs[0].Execution.RunAt)
+		assert.Equal(t, models.ExecutionStatusPending, runs[1].Execution.Status)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Claim Nothing Due", func(t *testing.T) {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery("SELECT (.+) FROM wallet_schedules WHERE status").
+			WithArgs(models.ScheduleStatusActive, 10).
+			WillReturnRows(sqlmock.NewRows(scheduleCols))
+		sqlMock.ExpectRollback()
+
+		runs, err := repo.ClaimDueSchedules(context.Background(), 10)
+
+		assert.NoError(t, err)
+		assert.Empty(t, runs)
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("Complete Execution", func(t *testing.T) {
+		transactionID := uuid.New()
+		execution := &models.ScheduleExecution{ID: uuid.New(), Status: models.ExecutionStatusSucceeded, TransactionID: &transactionID}
+
+		sqlMock.ExpectExec("UPDATE wallet_schedule_executions SET status = \\$1, transaction_id = \\$2, error = \\$3, finished_at = now\\(\\) WHERE id = \\$4").
+			WithArgs(models.ExecutionStatusSucceeded, &transactionID, "", execution.ID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.CompleteScheduleExecution(context.Background(), execution))
+		assert.Nil(t, sqlMock.ExpectationsWereMet())
 	})
 }
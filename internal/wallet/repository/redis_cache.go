@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
+	redisdb "github.com/22Fariz22/wallet/pkg/db/redis"
+	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// defaultWalletCacheTTL используется, если TTL в конфиге не задан
+	defaultWalletCacheTTL = 10 * time.Minute
+	// lockPollInterval как часто реплика, не получившая блокировку, проверяет кэш
+	lockPollInterval = 25 * time.Millisecond
+	// flushBatchSize сколько ключей удаляется за одну команду при сбросе кэша
+	flushBatchSize = 500
+)
+
+// setIfNewerScript записывает снимок кошелька, только если в кэше нет более новой версии.
+// Так запоздавшая запись старого баланса не может перетереть уже закэшированный новый.
+// KEYS[1] - ключ, ARGV[1] - JSON снимка, ARGV[2] - версия, ARGV[3] - TTL в миллисекундах
+var setIfNewerScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current then
+	local ok, decoded = pcall(cjson.decode, current)
+	if ok and type(decoded) == 'table' and tonumber(decoded.version) and tonumber(decoded.version) >= tonumber(ARGV[2]) then
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
+// releaseLockScript снимает блокировку, только если она все еще наша:
+// по истечении TTL ее могла взять другая реплика
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// walletCache кэш снимков кошельков в Redis под ключами <prefix>wallet_balance:<id>
+type walletCache struct {
+	client *redis.Client
+	logger logger.Logger
+	ttl    time.Duration
+	jitter time.Duration
+	prefix string
+
+	lockEnabled bool
+	lockTTL     time.Duration
+	lockWait    time.Duration
+}
+
+func newWalletCache(client *redis.Client, cfg config.RedisConfig, logger logger.Logger) *walletCache {
+	ttl := cfg.WalletAmountCasheTTL
+	if ttl <= 0 {
+		ttl = defaultWalletCacheTTL
+	}
+
+	return &walletCache{
+		client: client,
+		logger: logger,
+		ttl:    ttl,
+		jitter: max(cfg.WalletCacheTTLJitter, 0),
+		prefix: cfg.WalletCacheKeyPrefix,
+
+		lockEnabled: cfg.WalletCacheLockEnabled,
+		lockTTL:     cfg.WalletCacheLockTTL,
+		lockWait:    cfg.WalletCacheLockWait,
+	}
+}
+
+func (c *walletCache) key(walletID uuid.UUID) string {
+	return fmt.Sprintf("%swallet_balance:%s", c.prefix, walletID)
+}
+
+func (c *walletCache) lockKey(walletID uuid.UUID) string {
+	return fmt.Sprintf("%swallet_balance_lock:%s", c.prefix, walletID)
+}
+
+// expiration TTL очередной записи: базовый TTL плюс случайная добавка в пределах jitter
+func (c *walletCache) expiration() time.Duration {
+	if c.jitter == 0 {
+		return c.ttl
+	}
+	return c.ttl + rand.N(c.jitter)
+}
+
+// Get возвращает снимок кошелька из кэша, redis.Nil означает промах
+func (c *walletCache) Get(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
+	data, err := c.client.Get(ctx, c.key(walletID)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &models.Wallet{}
+	if err := json.Unmarshal(data, w); err != nil {
+		return nil, err
+	}
+	// Снимки, записанные до появления статуса кошелька, считаем промахом
+	if w.Status == "" {
+		return nil, redis.Nil
+	}
+
+	return w, nil
+}
+
+// Set кладет снимок кошелька в кэш, если он новее закэшированного
+func (c *walletCache) Set(ctx context.Context, w *models.Wallet) error {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	return setIfNewerScript.Run(ctx, c.client, []string{c.key(w.WalletID)},
+		string(data), w.Version, c.expiration().Milliseconds()).Err()
+}
+
+// Invalidate удаляет кэш кошельков. Вызывается, когда итог записи в БД неизвестен
+// или обновить кэш не удалось: следующее чтение пойдет в БД
+func (c *walletCache) Invalidate(ctx context.Context, walletIDs ...uuid.UUID) {
+	for _, walletID := range walletIDs {
+		err := c.client.Del(ctx, c.key(walletID)).Err()
+		if err != nil && !errors.Is(err, redisdb.ErrCircuitOpen) {
+			c.logger.Errorf("Failed to invalidate Redis cache: walletID=%s, error=%v", walletID, err)
+		}
+	}
+}
+
+// Refresh обновляет кэш после успешного коммита, а при ошибке удаляет ключ,
+// чтобы в кэше не остался устаревший баланс
+func (c *walletCache) Refresh(ctx context.Context, wallets ...*models.Wallet) {
+	for _, w := range wallets {
+		err := c.Set(ctx, w)
+		if errors.Is(err, redisdb.ErrCircuitOpen) {
+			// Redis недоступен: удалять тоже бесполезно, кэш сбросится при восстановлении
+			continue
+		}
+		if err != nil {
+			c.logger.Warnf("Failed to update Redis cache: walletID=%s, error=%v", w.WalletID, err)
+			c.Invalidate(ctx, w.WalletID)
+		}
+	}
+}
+
+// Flush удаляет все снимки кошельков. Нужен после недоступности Redis:
+// сбросить кэш после записей в это время не удавалось, и в нем могут остаться старые балансы
+func (c *walletCache) Flush(ctx context.Context) error {
+	iter := c.client.Scan(ctx, 0, c.prefix+"wallet_balance:*", flushBatchSize).Iterator()
+
+	keys := make([]string, 0, flushBatchSize)
+	deleted := 0
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == flushBatchSize {
+			if err := c.client.Unlink(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			deleted += len(keys)
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if err := c.client.Unlink(ctx, keys...).Err(); err != nil {
+			return err
+		}
+		deleted += len(keys)
+	}
+
+	c.logger.Infof("Wallet cache flushed: %d keys removed", deleted)
+	return nil
+}
+
+// Lock пытается взять блокировку на заполнение ключа кошелька.
+// Возвращает токен, по которому блокировку потом снимает Unlock
+func (c *walletCache) Lock(ctx context.Context, walletID uuid.UUID) (string, bool, error) {
+	token := uuid.NewString()
+	ok, err := c.client.SetNX(ctx, c.lockKey(walletID), token, c.lockTTL).Result()
+	if err != nil {
+		return "", false, err
+	}
+
+	return token, ok, nil
+}
+
+// Unlock снимает блокировку, взятую через Lock
+func (c *walletCache) Unlock(ctx context.Context, walletID uuid.UUID, token string) {
+	if err := releaseLockScript.Run(ctx, c.client, []string{c.lockKey(walletID)}, token).Err(); err != nil {
+		c.logger.Warnf("Failed to release cache lock: walletID=%s, error=%v", walletID, err)
+	}
+}
+
+// WaitFor ждет, пока реплика, владеющая блокировкой, заполнит кэш.
+// Возвращает false, если за lockWait снимок так и не появился
+func (c *walletCache) WaitFor(ctx context.Context, walletID uuid.UUID) (*models.Wallet, bool) {
+	deadline := time.Now().Add(c.lockWait)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(lockPollInterval):
+		}
+
+		if w, err := c.Get(ctx, walletID); err == nil {
+			return w, true
+		}
+		if time.Now().After(deadline) {
+			return nil, false
+		}
+	}
+}
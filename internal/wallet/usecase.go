@@ -3,12 +3,34 @@ package wallet
 import (
 	"context"
 
+	"github.com/22Fariz22/wallet/internal/models"
 	"github.com/google/uuid"
 )
 
 type Usecase interface {
-	Deposit(context context.Context, walletID uuid.UUID, amount int64) error
-	Withdraw(context context.Context, walletID uuid.UUID, amount int64) error
-	Display(context context.Context, walletID uuid.UUID) (int64, error)
-	CreateWallet(ctx context.Context) (uuid.UUID, error)
+	Deposit(context context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error)
+	Withdraw(context context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error)
+	Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (*models.Transaction, error)
+	Reverse(ctx context.Context, walletID, transactionID uuid.UUID, amount int64) (*models.Transaction, error)
+	Display(context context.Context, walletID uuid.UUID) (*models.Wallet, error)
+	Hold(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Hold, error)
+	Capture(ctx context.Context, walletID, holdID uuid.UUID, amount int64) (*models.Transaction, error)
+	Release(ctx context.Context, walletID, holdID uuid.UUID) (*models.Hold, error)
+	ExpireHolds(ctx context.Context) (int, error)
+	CreateSchedule(ctx context.Context, s *models.Schedule) (*models.Schedule, error)
+	ListSchedules(ctx context.Context, walletID uuid.UUID) ([]models.Schedule, error)
+	CancelSchedule(ctx context.Context, walletID, scheduleID uuid.UUID) (*models.Schedule, error)
+	GetScheduleExecutions(ctx context.Context, walletID, scheduleID uuid.UUID) ([]models.ScheduleExecution, error)
+	RunDueSchedules(ctx context.Context) (int, error)
+	CheckCurrency(ctx context.Context, walletID uuid.UUID, currency string) error
+	CreateWallet(ctx context.Context, params models.WalletParams) (*models.Wallet, error)
+	ListWallets(ctx context.Context, ownerID string) ([]models.Wallet, error)
+	UpdateStatus(ctx context.Context, walletID uuid.UUID, status string) (*models.Wallet, error)
+	GetTransactions(ctx context.Context, walletID uuid.UUID, filter models.TransactionFilter) (*models.TransactionPage, error)
+	GetLimits(ctx context.Context, walletID uuid.UUID) (*models.WalletLimits, error)
+	SetLimits(ctx context.Context, limits *models.WalletLimits) (*models.WalletLimits, error)
+	CheckLedger(ctx context.Context) (*models.LedgerCheck, error)
+	ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
 }
@@ -2,59 +2,387 @@ package usecase
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
 	"github.com/22Fariz22/wallet/internal/wallet"
+	"github.com/22Fariz22/wallet/pkg/currency"
 	"github.com/22Fariz22/wallet/pkg/logger"
 	"github.com/google/uuid"
-	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 100
+	// expireHoldsBatch сколько кошельков с истекшими холдами обрабатывается за один проход
+	expireHoldsBatch = 500
+	// scheduleExecutionsLimit сколько последних запусков расписания отдается в журнале
+	scheduleExecutionsLimit = 100
 )
 
 type walletUseCase struct {
-	cfg         *config.Config
-	walletRepo  wallet.Repository
-	redisClient *redis.Client
-	logger      logger.Logger
-	httpClient  *http.Client
+	cfg        *config.Config
+	walletRepo wallet.Repository
+	logger     logger.Logger
+	httpClient *http.Client
 }
 
 func NewWalletUseCase(
 	cfg *config.Config,
 	walletRepo wallet.Repository,
-	redisClient *redis.Client,
 	logger logger.Logger) wallet.Usecase {
 	httpClient := &http.Client{
 		Timeout: 5 * time.Second,
 	}
 
 	return &walletUseCase{
-		cfg:         cfg,
-		walletRepo:  walletRepo,
-		redisClient: redisClient,
-		logger:      logger,
-		httpClient:  httpClient,
+		cfg:        cfg,
+		walletRepo: walletRepo,
+		logger:     logger,
+		httpClient: httpClient,
 	}
 }
 
-func (u *walletUseCase) Display(ctx context.Context, walletID uuid.UUID) (int64, error) {
+func (u *walletUseCase) Display(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
 	u.logger.Info("Display usecase called")
 	return u.walletRepo.Display(ctx, walletID)
 }
 
-func (u *walletUseCase) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) error {
+// UpdateStatus меняет статус кошелька: заморозка, разморозка или закрытие
+func (u *walletUseCase) UpdateStatus(ctx context.Context, walletID uuid.UUID, status string) (*models.Wallet, error) {
+	u.logger.Infof("UpdateStatus usecase called: walletID=%s, status=%s", walletID, status)
+
+	switch status {
+	case models.WalletStatusActive, models.WalletStatusFrozen, models.WalletStatusClosed:
+	default:
+		return nil, wallet.ErrInvalidStatusTransition
+	}
+
+	return u.walletRepo.UpdateStatus(ctx, walletID, status)
+}
+
+// CheckCurrency проверяет, что валюта операции совпадает с валютой кошелька
+func (u *walletUseCase) CheckCurrency(ctx context.Context, walletID uuid.UUID, code string) error {
+	u.logger.Info("CheckCurrency usecase called")
+
+	w, err := u.walletRepo.Display(ctx, walletID)
+	if err != nil {
+		return err
+	}
+	if currency.Normalize(code) != w.Currency {
+		return wallet.ErrCurrencyMismatch
+	}
+
+	return nil
+}
+
+func (u *walletUseCase) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
 	u.logger.Info("Deposit usecase called")
+	if amount <= 0 {
+		return nil, wallet.ErrInvalidAmount
+	}
 	return u.walletRepo.Deposit(ctx, walletID, amount)
 }
 
-func (u *walletUseCase) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) error {
+func (u *walletUseCase) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
 	u.logger.Info("Withdraw usecase called")
+	if amount <= 0 {
+		return nil, wallet.ErrInvalidAmount
+	}
 	return u.walletRepo.Withdraw(ctx, walletID, amount)
 }
 
-func (u *walletUseCase) CreateWallet(ctx context.Context) (uuid.UUID, error) {
+func (u *walletUseCase) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (*models.Transaction, error) {
+	u.logger.Info("Transfer usecase called")
+	if amount <= 0 {
+		return nil, wallet.ErrInvalidAmount
+	}
+	if fromID == toID {
+		return nil, wallet.ErrSameWallet
+	}
+	return u.walletRepo.Transfer(ctx, fromID, toID, amount)
+}
+
+// Reverse сторнирует часть или всю сумму операции transactionID кошелька
+func (u *walletUseCase) Reverse(ctx context.Context, walletID, transactionID uuid.UUID, amount int64) (*models.Transaction, error) {
+	u.logger.Info("Reverse usecase called")
+	if amount <= 0 {
+		return nil, wallet.ErrInvalidAmount
+	}
+	return u.walletRepo.Reverse(ctx, walletID, transactionID, amount)
+}
+
+// Hold резервирует amount на кошельке на время из настроек WALLET_HOLD_TTL
+func (u *walletUseCase) Hold(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Hold, error) {
+	u.logger.Info("Hold usecase called")
+	if amount <= 0 {
+		return nil, wallet.ErrInvalidAmount
+	}
+	return u.walletRepo.CreateHold(ctx, walletID, amount, time.Now().Add(u.cfg.Wallet.HoldTTL))
+}
+
+// Capture списывает часть или весь остаток холда
+func (u *walletUseCase) Capture(ctx context.Context, walletID, holdID uuid.UUID, amount int64) (*models.Transaction, error) {
+	u.logger.Info("Capture usecase called")
+	if amount <= 0 {
+		return nil, wallet.ErrInvalidAmount
+	}
+	return u.walletRepo.CaptureHold(ctx, walletID, holdID, amount)
+}
+
+// Release снимает холд, его остаток снова становится доступным
+func (u *walletUseCase) Release(ctx context.Context, walletID, holdID uuid.UUID) (*models.Hold, error) {
+	u.logger.Info("Release usecase called")
+	return u.walletRepo.ReleaseHold(ctx, walletID, holdID)
+}
+
+// ExpireHolds снимает истекшие холды и возвращает число затронутых кошельков
+func (u *walletUseCase) ExpireHolds(ctx context.Context) (int, error) {
+	walletIDs, err := u.walletRepo.ExpireHolds(ctx, expireHoldsBatch)
+	return len(walletIDs), err
+}
+
+// CreateSchedule проверяет и сохраняет расписание. Из s берутся кошелек, операция,
+// сумма, кошелек получателя, время первого запуска (StartAt) и периодичность
+func (u *walletUseCase) CreateSchedule(ctx context.Context, s *models.Schedule) (*models.Schedule, error) {
+	u.logger.Info("CreateSchedule usecase called")
+
+	switch s.OperationType {
+	case models.TransactionTypeDeposit, models.TransactionTypeWithdraw:
+		s.ToWalletID = nil
+	case models.OperationTypeTransfer:
+		if s.ToWalletID == nil {
+			return nil, wallet.ErrInvalidSchedule
+		}
+	default:
+		return nil, wallet.ErrInvalidSchedule
+	}
+	if !models.ValidRecurrence(s.Recurrence) {
+		return nil, wallet.ErrInvalidSchedule
+	}
+	if s.Amount <= 0 {
+		return nil, wallet.ErrInvalidAmount
+	}
+	if !s.StartAt.After(time.Now()) {
+		return nil, wallet.ErrScheduleInPast
+	}
+
+	// Кошельки проверяются сейчас, чтобы ошибка в ID не всплыла только при запуске
+	if _, err := u.walletRepo.Display(ctx, s.WalletID); err != nil {
+		return nil, err
+	}
+	if s.ToWalletID != nil {
+		if *s.ToWalletID == s.WalletID {
+			return nil, wallet.ErrSameWallet
+		}
+		if _, err := u.walletRepo.Display(ctx, *s.ToWalletID); err != nil {
+			return nil, err
+		}
+	}
+
+	s.ID = uuid.New()
+	return u.walletRepo.CreateSchedule(ctx, s)
+}
+
+func (u *walletUseCase) ListSchedules(ctx context.Context, walletID uuid.UUID) ([]models.Schedule, error) {
+	u.logger.Info("ListSchedules usecase called")
+
+	// Пустой список у несуществующего кошелька выглядел бы как успех
+	if _, err := u.walletRepo.Display(ctx, walletID); err != nil {
+		return nil, err
+	}
+	return u.walletRepo.ListSchedules(ctx, walletID)
+}
+
+func (u *walletUseCase) CancelSchedule(ctx context.Context, walletID, scheduleID uuid.UUID) (*models.Schedule, error) {
+	u.logger.Info("CancelSchedule usecase called")
+	return u.walletRepo.CancelSchedule(ctx, walletID, scheduleID)
+}
+
+func (u *walletUseCase) GetScheduleExecutions(ctx context.Context, walletID, scheduleID uuid.UUID) ([]models.ScheduleExecution, error) {
+	u.logger.Info("GetScheduleExecutions usecase called")
+	return u.walletRepo.GetScheduleExecutions(ctx, walletID, scheduleID, scheduleExecutionsLimit)
+}
+
+// RunDueSchedules выполняет наступившие запуски расписаний и возвращает их число.
+// Ошибка операции пишется в журнал запусков и не прерывает остальные
+func (u *walletUseCase) RunDueSchedules(ctx context.Context) (int, error) {
+	runs, err := u.walletRepo.ClaimDueSchedules(ctx, u.cfg.Wallet.ScheduleBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, run := range runs {
+		execution := run.Execution
+		transaction, err := u.runSchedule(ctx, &run.Schedule)
+		if err != nil {
+			u.logger.Warnf("Scheduled operation failed: schedule %s, error: %v", run.Schedule.ID, err)
+			execution.Status = models.ExecutionStatusFailed
+			execution.Error = err.Error()
+		} else {
+			execution.Status = models.ExecutionStatusSucceeded
+			execution.TransactionID = &transaction.ID
+		}
+
+		// Запуск уже выполнен: результат записывается и при остановке воркера
+		if err := u.walletRepo.CompleteScheduleExecution(context.WithoutCancel(ctx), &execution); err != nil {
+			u.logger.Errorf("Failed to record schedule result: execution %s, error: %v", execution.ID, err)
+		}
+	}
+
+	return len(runs), nil
+}
+
+// runSchedule выполняет операцию расписания теми же методами, что и запрос клиента
+func (u *walletUseCase) runSchedule(ctx context.Context, s *models.Schedule) (*models.Transaction, error) {
+	switch s.OperationType {
+	case models.TransactionTypeDeposit:
+		return u.Deposit(ctx, s.WalletID, s.Amount)
+	case models.TransactionTypeWithdraw:
+		return u.Withdraw(ctx, s.WalletID, s.Amount)
+	case models.OperationTypeTransfer:
+		if s.ToWalletID == nil {
+			return nil, fmt.Errorf("transfer schedule %s has no destination wallet", s.ID)
+		}
+		return u.Transfer(ctx, s.WalletID, *s.ToWalletID, s.Amount)
+	default:
+		return nil, fmt.Errorf("unsupported scheduled operation %q", s.OperationType)
+	}
+}
+
+// CreateWallet создает кошелек в указанной валюте, пустая валюта означает валюту по умолчанию.
+// С заданным клиентом ID создание идемпотентно
+func (u *walletUseCase) CreateWallet(ctx context.Context, params models.WalletParams) (*models.Wallet, error) {
 	u.logger.Info("CreateWallet usecase called")
-	walletID := uuid.New()
-	return u.walletRepo.CreateWallet(ctx, walletID)
+
+	code := params.Currency
+	if code == "" {
+		code = u.cfg.Wallet.DefaultCurrency
+	}
+	code = currency.Normalize(code)
+	if !currency.IsSupported(code) {
+		return nil, wallet.ErrUnsupportedCurrency
+	}
+
+	requested := &models.Wallet{
+		WalletID: params.WalletID,
+		Currency: code,
+		OwnerID:  params.OwnerID,
+		Label:    params.Label,
+		Metadata: params.Metadata,
+	}
+	if requested.WalletID == uuid.Nil {
+		requested.WalletID = uuid.New()
+	}
+
+	w, err := u.walletRepo.CreateWallet(ctx, requested)
+	if err != nil {
+		return nil, err
+	}
+
+	// Повтор того же запроса получает уже созданный кошелек,
+	// тот же ID с другими атрибутами означает ошибку клиента
+	if !w.SameAttributes(requested) {
+		return nil, wallet.ErrWalletExists
+	}
+
+	return w, nil
+}
+
+// ListWallets возвращает кошельки клиента
+func (u *walletUseCase) ListWallets(ctx context.Context, ownerID string) ([]models.Wallet, error) {
+	u.logger.Info("ListWallets usecase called")
+	return u.walletRepo.ListWallets(ctx, ownerID)
+}
+
+// GetLimits возвращает действующие лимиты кошелька
+func (u *walletUseCase) GetLimits(ctx context.Context, walletID uuid.UUID) (*models.WalletLimits, error) {
+	u.logger.Info("GetLimits usecase called")
+	return u.walletRepo.GetLimits(ctx, walletID)
+}
+
+// SetLimits задает собственные лимиты кошелька, незаданные поля берутся по умолчанию
+func (u *walletUseCase) SetLimits(ctx context.Context, limits *models.WalletLimits) (*models.WalletLimits, error) {
+	u.logger.Infof("SetLimits usecase called: walletID=%s", limits.WalletID)
+
+	for _, limit := range []*int64{limits.MaxOperationAmount, limits.MaxBalance, limits.DailyWithdrawalLimit, limits.MonthlyWithdrawalLimit} {
+		if limit != nil && *limit < 0 {
+			return nil, wallet.ErrInvalidLimit
+		}
+	}
+
+	return u.walletRepo.SetLimits(ctx, limits)
+}
+
+// CheckLedger сверяет главную книгу с балансами кошельков
+func (u *walletUseCase) CheckLedger(ctx context.Context) (*models.LedgerCheck, error) {
+	u.logger.Info("CheckLedger usecase called")
+	return u.walletRepo.CheckLedger(ctx)
+}
+
+// GetTransactions возвращает страницу журнала операций кошелька
+func (u *walletUseCase) GetTransactions(ctx context.Context, walletID uuid.UUID, filter models.TransactionFilter) (*models.TransactionPage, error) {
+	u.logger.Info("GetTransactions usecase called")
+
+	// Для несуществующего кошелька отдаем ошибку, а не пустую историю
+	if _, err := u.walletRepo.Display(ctx, walletID); err != nil {
+		return nil, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultTransactionsLimit
+	}
+	if filter.Limit > maxTransactionsLimit {
+		filter.Limit = maxTransactionsLimit
+	}
+
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	transactions, err := u.walletRepo.GetTransactions(ctx, walletID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		last := page.Transactions[limit-1]
+		page.NextCursor = models.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// ReserveIdempotencyKey занимает ключ идемпотентности. Возвращает nil, если операцию
+// нужно выполнить, или сохраненный результат, если это повтор завершенного запроса
+func (u *walletUseCase) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*models.IdempotencyKey, error) {
+	u.logger.Info("ReserveIdempotencyKey usecase called")
+
+	record, err := u.walletRepo.ReserveIdempotencyKey(ctx, key, requestHash)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	if record.RequestHash != requestHash {
+		return nil, wallet.ErrIdempotencyKeyReused
+	}
+	if record.StatusCode == 0 {
+		return nil, wallet.ErrOperationInProgress
+	}
+
+	return record, nil
+}
+
+func (u *walletUseCase) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	u.logger.Info("CompleteIdempotencyKey usecase called")
+	return u.walletRepo.CompleteIdempotencyKey(ctx, key, statusCode, response)
+}
+
+func (u *walletUseCase) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	u.logger.Info("ReleaseIdempotencyKey usecase called")
+	return u.walletRepo.ReleaseIdempotencyKey(ctx, key)
 }
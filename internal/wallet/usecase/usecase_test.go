@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/internal/models"
+	"github.com/22Fariz22/wallet/internal/wallet"
 	"github.com/22Fariz22/wallet/internal/wallet/usecase"
 	"github.com/22Fariz22/wallet/pkg/logger"
 	"github.com/google/uuid"
@@ -19,24 +21,151 @@ type MockWalletRepo struct {
 	mock.Mock
 }
 
-func (m *MockWalletRepo) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) error {
+func (m *MockWalletRepo) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
 	args := m.Called(ctx, walletID, amount)
-	return args.Error(0)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
 }
 
-func (m *MockWalletRepo) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) error {
+func (m *MockWalletRepo) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
 	args := m.Called(ctx, walletID, amount)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
+}
+
+func (m *MockWalletRepo) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, fromID, toID, amount)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
+}
+
+func (m *MockWalletRepo) Reverse(ctx context.Context, walletID, transactionID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, walletID, transactionID, amount)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
+}
+
+func (m *MockWalletRepo) CreateHold(ctx context.Context, walletID uuid.UUID, amount int64, expiresAt time.Time) (*models.Hold, error) {
+	args := m.Called(ctx, walletID, amount, expiresAt)
+	hold, _ := args.Get(0).(*models.Hold)
+	return hold, args.Error(1)
+}
+
+func (m *MockWalletRepo) CaptureHold(ctx context.Context, walletID, holdID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, walletID, holdID, amount)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
+}
+
+func (m *MockWalletRepo) ReleaseHold(ctx context.Context, walletID, holdID uuid.UUID) (*models.Hold, error) {
+	args := m.Called(ctx, walletID, holdID)
+	hold, _ := args.Get(0).(*models.Hold)
+	return hold, args.Error(1)
+}
+
+func (m *MockWalletRepo) ExpireHolds(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	args := m.Called(ctx, limit)
+	walletIDs, _ := args.Get(0).([]uuid.UUID)
+	return walletIDs, args.Error(1)
+}
+
+func (m *MockWalletRepo) CreateSchedule(ctx context.Context, s *models.Schedule) (*models.Schedule, error) {
+	args := m.Called(ctx, s)
+	created, _ := args.Get(0).(*models.Schedule)
+	return created, args.Error(1)
+}
+
+func (m *MockWalletRepo) ListSchedules(ctx context.Context, walletID uuid.UUID) ([]models.Schedule, error) {
+	args := m.Called(ctx, walletID)
+	schedules, _ := args.Get(0).([]models.Schedule)
+	return schedules, args.Error(1)
+}
+
+func (m *MockWalletRepo) CancelSchedule(ctx context.Context, walletID, scheduleID uuid.UUID) (*models.Schedule, error) {
+	args := m.Called(ctx, walletID, scheduleID)
+	schedule, _ := args.Get(0).(*models.Schedule)
+	return schedule, args.Error(1)
+}
+
+func (m *MockWalletRepo) GetScheduleExecutions(ctx context.Context, walletID, scheduleID uuid.UUID, limit int) ([]models.ScheduleExecution, error) {
+	args := m.Called(ctx, walletID, scheduleID, limit)
+	executions, _ := args.Get(0).([]models.ScheduleExecution)
+	return executions, args.Error(1)
+}
+
+func (m *MockWalletRepo) ClaimDueSchedules(ctx context.Context, limit int) ([]models.ScheduledRun, error) {
+	args := m.Called(ctx, limit)
+	runs, _ := args.Get(0).([]models.ScheduledRun)
+	return runs, args.Error(1)
+}
+
+func (m *MockWalletRepo) CompleteScheduleExecution(ctx context.Context, execution *models.ScheduleExecution) error {
+	args := m.Called(ctx, execution)
 	return args.Error(0)
 }
 
-func (m *MockWalletRepo) Display(ctx context.Context, walletID uuid.UUID) (int64, error) {
+func (m *MockWalletRepo) Display(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
+	args := m.Called(ctx, walletID)
+	w, _ := args.Get(0).(*models.Wallet)
+	return w, args.Error(1)
+}
+
+func (m *MockWalletRepo) UpdateStatus(ctx context.Context, walletID uuid.UUID, status string) (*models.Wallet, error) {
+	args := m.Called(ctx, walletID, status)
+	w, _ := args.Get(0).(*models.Wallet)
+	return w, args.Error(1)
+}
+
+func (m *MockWalletRepo) CreateWallet(ctx context.Context, w *models.Wallet) (*models.Wallet, error) {
+	args := m.Called(ctx, w)
+	created, _ := args.Get(0).(*models.Wallet)
+	return created, args.Error(1)
+}
+
+func (m *MockWalletRepo) ListWallets(ctx context.Context, ownerID string) ([]models.Wallet, error) {
+	args := m.Called(ctx, ownerID)
+	wallets, _ := args.Get(0).([]models.Wallet)
+	return wallets, args.Error(1)
+}
+
+func (m *MockWalletRepo) GetTransactions(ctx context.Context, walletID uuid.UUID, filter models.TransactionFilter) ([]models.Transaction, error) {
+	args := m.Called(ctx, walletID, filter)
+	transactions, _ := args.Get(0).([]models.Transaction)
+	return transactions, args.Error(1)
+}
+
+func (m *MockWalletRepo) GetLimits(ctx context.Context, walletID uuid.UUID) (*models.WalletLimits, error) {
 	args := m.Called(ctx, walletID)
-	return args.Get(0).(int64), args.Error(1)
+	limits, _ := args.Get(0).(*models.WalletLimits)
+	return limits, args.Error(1)
 }
 
-func (m *MockWalletRepo) CreateWallet(ctx context.Context, walletID uuid.UUID) (uuid.UUID, error) {
+func (m *MockWalletRepo) SetLimits(ctx context.Context, limits *models.WalletLimits) (*models.WalletLimits, error) {
+	args := m.Called(ctx, limits)
+	updated, _ := args.Get(0).(*models.WalletLimits)
+	return updated, args.Error(1)
+}
+
+func (m *MockWalletRepo) CheckLedger(ctx context.Context) (*models.LedgerCheck, error) {
 	args := m.Called(ctx)
-	return args.Get(0).(uuid.UUID), args.Error(1)
+	check, _ := args.Get(0).(*models.LedgerCheck)
+	return check, args.Error(1)
+}
+
+func (m *MockWalletRepo) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*models.IdempotencyKey, error) {
+	args := m.Called(ctx, key, requestHash)
+	record, _ := args.Get(0).(*models.IdempotencyKey)
+	return record, args.Error(1)
+}
+
+func (m *MockWalletRepo) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	args := m.Called(ctx, key, statusCode, response)
+	return args.Error(0)
+}
+
+func (m *MockWalletRepo) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
 }
 
 type MockRedisClient struct {
@@ -56,86 +185,490 @@ func (m *MockRedisClient) Set(ctx context.Context, key string, value string, exp
 func TestWalletUseCase(t *testing.T) {
 	mockRepo := new(MockWalletRepo)
 	mockLogger := logger.NewMockLogger()
-	cfg := &config.Config{}
-	useCase := usecase.NewWalletUseCase(cfg, mockRepo, nil, mockLogger)
+	cfg := &config.Config{Wallet: config.WalletConfig{DefaultCurrency: "RUB", HoldTTL: time.Hour, ScheduleBatchSize: 100}}
+	useCase := usecase.NewWalletUseCase(cfg, mockRepo, mockLogger)
 
 	ctx := context.Background()
 	walletID := uuid.New()
 	amount := int64(100)
 
 	t.Run("Deposit Success", func(t *testing.T) {
-		mockRepo.On("Deposit", ctx, walletID, amount).Return(nil).Once()
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeDeposit, Amount: amount}
+		mockRepo.On("Deposit", ctx, walletID, amount).Return(transaction, nil).Once()
 
-		err := useCase.Deposit(ctx, walletID, amount)
+		result, err := useCase.Deposit(ctx, walletID, amount)
 
 		assert.NoError(t, err)
+		assert.Equal(t, transaction, result)
 		mockRepo.AssertExpectations(t)
 	})
 
 	t.Run("Deposit Error", func(t *testing.T) {
-		mockRepo.On("Deposit", ctx, walletID, amount).Return(errors.New("deposit error")).Once()
+		mockRepo.On("Deposit", ctx, walletID, amount).Return(nil, errors.New("deposit error")).Once()
 
-		err := useCase.Deposit(ctx, walletID, amount)
+		_, err := useCase.Deposit(ctx, walletID, amount)
 
 		assert.EqualError(t, err, "deposit error")
 		mockRepo.AssertExpectations(t)
 	})
 
+	t.Run("Deposit Invalid Amount", func(t *testing.T) {
+		_, err := useCase.Deposit(ctx, walletID, -amount)
+
+		assert.ErrorIs(t, err, wallet.ErrInvalidAmount)
+		mockRepo.AssertNotCalled(t, "Deposit", ctx, walletID, -amount)
+	})
+
 	t.Run("Withdraw Success", func(t *testing.T) {
-		mockRepo.On("Withdraw", ctx, walletID, amount).Return(nil).Once()
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeWithdraw, Amount: amount}
+		mockRepo.On("Withdraw", ctx, walletID, amount).Return(transaction, nil).Once()
 
-		err := useCase.Withdraw(ctx, walletID, amount)
+		result, err := useCase.Withdraw(ctx, walletID, amount)
 
 		assert.NoError(t, err)
+		assert.Equal(t, transaction, result)
 		mockRepo.AssertExpectations(t)
 	})
 
 	t.Run("Withdraw Error", func(t *testing.T) {
-		mockRepo.On("Withdraw", ctx, walletID, amount).Return(errors.New("withdraw error")).Once()
+		mockRepo.On("Withdraw", ctx, walletID, amount).Return(nil, errors.New("withdraw error")).Once()
 
-		err := useCase.Withdraw(ctx, walletID, amount)
+		_, err := useCase.Withdraw(ctx, walletID, amount)
 
 		assert.EqualError(t, err, "withdraw error")
 		mockRepo.AssertExpectations(t)
 	})
 
+	t.Run("Reverse Success", func(t *testing.T) {
+		originalID := uuid.New()
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeReversal, Amount: 30, ReversalOf: &originalID}
+		mockRepo.On("Reverse", ctx, walletID, originalID, int64(30)).Return(transaction, nil).Once()
+
+		result, err := useCase.Reverse(ctx, walletID, originalID, 30)
+
+		assert.NoError(t, err)
+		assert.Equal(t, transaction, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Reverse Invalid Amount", func(t *testing.T) {
+		_, err := useCase.Reverse(ctx, walletID, uuid.New(), 0)
+
+		assert.ErrorIs(t, err, wallet.ErrInvalidAmount)
+		mockRepo.AssertNumberOfCalls(t, "Reverse", 1)
+	})
+
+	t.Run("CreateSchedule Transfer", func(t *testing.T) {
+		toID := uuid.New()
+		schedule := &models.Schedule{
+			WalletID: walletID, OperationType: models.OperationTypeTransfer, ToWalletID: &toID,
+			Amount: amount, Recurrence: models.RecurrenceWeekly, StartAt: time.Now().Add(time.Hour),
+		}
+		mockRepo.On("Display", ctx, walletID).Return(&models.Wallet{WalletID: walletID}, nil).Once()
+		mockRepo.On("Display", ctx, toID).Return(&models.Wallet{WalletID: toID}, nil).Once()
+		mockRepo.On("CreateSchedule", ctx, mock.MatchedBy(func(s *models.Schedule) bool {
+			return s.ID != uuid.Nil && s.WalletID == walletID && *s.ToWalletID == toID
+		})).Return(schedule, nil).Once()
+
+		result, err := useCase.CreateSchedule(ctx, schedule)
+
+		assert.NoError(t, err)
+		assert.Equal(t, schedule, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("CreateSchedule Rejected", func(t *testing.T) {
+		future := time.Now().Add(time.Hour)
+		tests := []struct {
+			name     string
+			schedule models.Schedule
+			err      error
+		}{
+			{"In Past", models.Schedule{WalletID: walletID, OperationType: models.TransactionTypeDeposit, Amount: amount, StartAt: time.Now().Add(-time.Minute)}, wallet.ErrScheduleInPast},
+			{"Unknown Recurrence", models.Schedule{WalletID: walletID, OperationType: models.TransactionTypeDeposit, Amount: amount, Recurrence: "hourly", StartAt: future}, wallet.ErrInvalidSchedule},
+			{"Transfer Without Destination", models.Schedule{WalletID: walletID, OperationType: models.OperationTypeTransfer, Amount: amount, StartAt: future}, wallet.ErrInvalidSchedule},
+			{"Unsupported Operation", models.Schedule{WalletID: walletID, OperationType: models.OperationTypeHold, Amount: amount, StartAt: future}, wallet.ErrInvalidSchedule},
+			{"Zero Amount", models.Schedule{WalletID: walletID, OperationType: models.TransactionTypeWithdraw, StartAt: future}, wallet.ErrInvalidAmount},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				schedule := tt.schedule
+				_, err := useCase.CreateSchedule(ctx, &schedule)
+
+				assert.ErrorIs(t, err, tt.err)
+			})
+		}
+		mockRepo.AssertNumberOfCalls(t, "CreateSchedule", 1)
+	})
+
+	t.Run("RunDueSchedules", func(t *testing.T) {
+		succeeded := models.ScheduledRun{
+			Schedule:  models.Schedule{ID: uuid.New(), WalletID: walletID, OperationType: models.TransactionTypeDeposit, Amount: amount},
+			Execution: models.ScheduleExecution{ID: uuid.New(), Status: models.ExecutionStatusPending},
+		}
+		failed := models.ScheduledRun{
+			Schedule:  models.Schedule{ID: uuid.New(), WalletID: walletID, OperationType: models.TransactionTypeWithdraw, Amount: amount},
+			Execution: models.ScheduleExecution{ID: uuid.New(), Status: models.ExecutionStatusPending},
+		}
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeDeposit, Amount: amount}
+
+		mockRepo.On("ClaimDueSchedules", ctx, 100).Return([]models.ScheduledRun{succeeded, failed}, nil).Once()
+		mockRepo.On("Deposit", ctx, walletID, amount).Return(transaction, nil).Once()
+		mockRepo.On("Withdraw", ctx, walletID, amount).Return(nil, wallet.ErrInsufficientFunds).Once()
+		mockRepo.On("CompleteScheduleExecution", mock.Anything, mock.MatchedBy(func(e *models.ScheduleExecution) bool {
+			return e.ID == succeeded.Execution.ID && e.Status == models.ExecutionStatusSucceeded && *e.TransactionID == transaction.ID
+		})).Return(nil).Once()
+		// Неудачный запуск попадает в журнал с текстом ошибки и не прерывает остальные
+		mockRepo.On("CompleteScheduleExecution", mock.Anything, mock.MatchedBy(func(e *models.ScheduleExecution) bool {
+			return e.ID == failed.Execution.ID && e.Status == models.ExecutionStatusFailed && e.Error == wallet.ErrInsufficientFunds.Error()
+		})).Return(nil).Once()
+
+		executed, err := useCase.RunDueSchedules(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, executed)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Hold Success", func(t *testing.T) {
+		hold := &models.Hold{ID: uuid.New(), WalletID: walletID, Amount: amount, Status: models.HoldStatusActive}
+		mockRepo.On("CreateHold", ctx, walletID, amount, mock.MatchedBy(func(expiresAt time.Time) bool {
+			// Срок холда отсчитывается от текущего момента на WALLET_HOLD_TTL
+			return expiresAt.After(time.Now().Add(59*time.Minute)) && !expiresAt.After(time.Now().Add(time.Hour))
+		})).Return(hold, nil).Once()
+
+		result, err := useCase.Hold(ctx, walletID, amount)
+
+		assert.NoError(t, err)
+		assert.Equal(t, hold, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Hold Invalid Amount", func(t *testing.T) {
+		_, err := useCase.Hold(ctx, walletID, 0)
+
+		assert.ErrorIs(t, err, wallet.ErrInvalidAmount)
+		mockRepo.AssertNumberOfCalls(t, "CreateHold", 1)
+	})
+
+	t.Run("Capture Success", func(t *testing.T) {
+		holdID := uuid.New()
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeCapture, Amount: 40}
+		mockRepo.On("CaptureHold", ctx, walletID, holdID, int64(40)).Return(transaction, nil).Once()
+
+		result, err := useCase.Capture(ctx, walletID, holdID, 40)
+
+		assert.NoError(t, err)
+		assert.Equal(t, transaction, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Capture Invalid Amount", func(t *testing.T) {
+		_, err := useCase.Capture(ctx, walletID, uuid.New(), -1)
+
+		assert.ErrorIs(t, err, wallet.ErrInvalidAmount)
+		mockRepo.AssertNumberOfCalls(t, "CaptureHold", 1)
+	})
+
+	t.Run("Release Not Active", func(t *testing.T) {
+		holdID := uuid.New()
+		mockRepo.On("ReleaseHold", ctx, walletID, holdID).Return(nil, wallet.ErrHoldNotActive).Once()
+
+		_, err := useCase.Release(ctx, walletID, holdID)
+
+		assert.ErrorIs(t, err, wallet.ErrHoldNotActive)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("ExpireHolds", func(t *testing.T) {
+		mockRepo.On("ExpireHolds", ctx, mock.AnythingOfType("int")).Return([]uuid.UUID{uuid.New(), uuid.New()}, nil).Once()
+
+		expired, err := useCase.ExpireHolds(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, expired)
+		mockRepo.AssertExpectations(t)
+	})
+
 	t.Run("Display Success", func(t *testing.T) {
-		mockRepo.On("Display", ctx, walletID).Return(amount, nil).Once()
+		w := &models.Wallet{WalletID: walletID, Amount: amount, Currency: "RUB"}
+		mockRepo.On("Display", ctx, walletID).Return(w, nil).Once()
 
-		balance, err := useCase.Display(ctx, walletID)
+		result, err := useCase.Display(ctx, walletID)
 
 		assert.NoError(t, err)
-		assert.Equal(t, amount, balance)
+		assert.Equal(t, w, result)
 		mockRepo.AssertExpectations(t)
 	})
 
 	t.Run("Display Error", func(t *testing.T) {
-		mockRepo.On("Display", ctx, walletID).Return(int64(0), errors.New("display error")).Once()
+		mockRepo.On("Display", ctx, walletID).Return(nil, errors.New("display error")).Once()
 
-		balance, err := useCase.Display(ctx, walletID)
+		result, err := useCase.Display(ctx, walletID)
 
 		assert.EqualError(t, err, "display error")
-		assert.Equal(t, int64(0), balance)
+		assert.Nil(t, result)
 		mockRepo.AssertExpectations(t)
 	})
+
+	t.Run("CheckCurrency Match", func(t *testing.T) {
+		w := &models.Wallet{WalletID: walletID, Amount: amount, Currency: "RUB"}
+		mockRepo.On("Display", ctx, walletID).Return(w, nil).Once()
+
+		err := useCase.CheckCurrency(ctx, walletID, "rub")
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("CheckCurrency Mismatch", func(t *testing.T) {
+		w := &models.Wallet{WalletID: walletID, Amount: amount, Currency: "RUB"}
+		mockRepo.On("Display", ctx, walletID).Return(w, nil).Once()
+
+		err := useCase.CheckCurrency(ctx, walletID, "USD")
+
+		assert.ErrorIs(t, err, wallet.ErrCurrencyMismatch)
+		mockRepo.AssertExpectations(t)
+	})
+
 	t.Run("CreateWallet Success", func(t *testing.T) {
-		newWalletID := uuid.New()
-		mockRepo.On("CreateWallet", ctx).Return(newWalletID, nil).Once()
+		created := &models.Wallet{WalletID: uuid.New(), Currency: "USD", OwnerID: "user-1", Label: "savings"}
+		mockRepo.On("CreateWallet", ctx, mock.MatchedBy(func(w *models.Wallet) bool {
+			return w.WalletID != uuid.Nil && w.Currency == "USD" && w.OwnerID == "user-1" && w.Label == "savings"
+		})).Return(created, nil).Once()
 
-		resultID, err := useCase.CreateWallet(ctx)
+		result, err := useCase.CreateWallet(ctx, models.WalletParams{OwnerID: "user-1", Label: "savings", Currency: "usd"})
 
 		assert.NoError(t, err)
-		assert.Equal(t, newWalletID, resultID)
+		assert.Equal(t, created, result)
 		mockRepo.AssertExpectations(t)
 	})
 
+	t.Run("CreateWallet Default Currency", func(t *testing.T) {
+		created := &models.Wallet{WalletID: uuid.New(), Currency: "RUB"}
+		mockRepo.On("CreateWallet", ctx, mock.MatchedBy(func(w *models.Wallet) bool {
+			return w.Currency == "RUB"
+		})).Return(created, nil).Once()
+
+		result, err := useCase.CreateWallet(ctx, models.WalletParams{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "RUB", result.Currency)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("CreateWallet Client ID Replay", func(t *testing.T) {
+		clientID := uuid.New()
+		// Кошелек уже создан первым запросом и успел поменять баланс, jsonb переупорядочил ключи
+		existing := &models.Wallet{
+			WalletID: clientID, Amount: 300, Currency: "USD", OwnerID: "user-1",
+			Metadata: models.Metadata(`{"a": 1, "b": 2}`),
+		}
+		mockRepo.On("CreateWallet", ctx, mock.MatchedBy(func(w *models.Wallet) bool {
+			return w.WalletID == clientID
+		})).Return(existing, nil).Once()
+
+		result, err := useCase.CreateWallet(ctx, models.WalletParams{
+			WalletID: clientID, OwnerID: "user-1", Currency: "USD", Metadata: models.Metadata(`{"b":2,"a":1}`),
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, existing, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("CreateWallet Client ID Conflict", func(t *testing.T) {
+		clientID := uuid.New()
+		existing := &models.Wallet{WalletID: clientID, Currency: "USD", OwnerID: "user-2"}
+		mockRepo.On("CreateWallet", ctx, mock.MatchedBy(func(w *models.Wallet) bool {
+			return w.WalletID == clientID
+		})).Return(existing, nil).Once()
+
+		result, err := useCase.CreateWallet(ctx, models.WalletParams{WalletID: clientID, OwnerID: "user-1", Currency: "USD"})
+
+		assert.ErrorIs(t, err, wallet.ErrWalletExists)
+		assert.Nil(t, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("CreateWallet Unsupported Currency", func(t *testing.T) {
+		_, err := useCase.CreateWallet(ctx, models.WalletParams{Currency: "XXX"})
+
+		assert.ErrorIs(t, err, wallet.ErrUnsupportedCurrency)
+	})
+
 	t.Run("CreateWallet Error", func(t *testing.T) {
-		mockRepo.On("CreateWallet", ctx).Return(uuid.Nil, errors.New("create wallet error")).Once()
+		mockRepo.On("CreateWallet", ctx, mock.AnythingOfType("*models.Wallet")).Return(nil, errors.New("create wallet error")).Once()
 
-		resultID, err := useCase.CreateWallet(ctx)
+		result, err := useCase.CreateWallet(ctx, models.WalletParams{Currency: "RUB"})
 
 		assert.EqualError(t, err, "create wallet error")
-		assert.Equal(t, uuid.Nil, resultID)
+		assert.Nil(t, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("ListWallets Success", func(t *testing.T) {
+		wallets := []models.Wallet{{WalletID: uuid.New(), OwnerID: "user-1"}}
+		mockRepo.On("ListWallets", ctx, "user-1").Return(wallets, nil).Once()
+
+		result, err := useCase.ListWallets(ctx, "user-1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, wallets, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("SetLimits Success", func(t *testing.T) {
+		maxBalance := int64(100000)
+		limits := &models.WalletLimits{WalletID: walletID, MaxBalance: &maxBalance}
+		mockRepo.On("SetLimits", ctx, limits).Return(limits, nil).Once()
+
+		result, err := useCase.SetLimits(ctx, limits)
+
+		assert.NoError(t, err)
+		assert.Equal(t, limits, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("SetLimits Negative", func(t *testing.T) {
+		negative := int64(-1)
+
+		_, err := useCase.SetLimits(ctx, &models.WalletLimits{WalletID: walletID, DailyWithdrawalLimit: &negative})
+
+		assert.ErrorIs(t, err, wallet.ErrInvalidLimit)
+		// Репозиторий вызывался только в предыдущем сценарии
+		mockRepo.AssertNumberOfCalls(t, "SetLimits", 1)
+	})
+
+	t.Run("CheckLedger", func(t *testing.T) {
+		check := &models.LedgerCheck{Balanced: true, SystemAccounts: map[string]int64{"funding": -amount}}
+		mockRepo.On("CheckLedger", ctx).Return(check, nil).Once()
+
+		result, err := useCase.CheckLedger(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, check, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("GetTransactions Last Page", func(t *testing.T) {
+		transactions := []models.Transaction{
+			{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeDeposit, Amount: amount, BalanceAfter: amount},
+		}
+		mockRepo.On("Display", ctx, walletID).Return(&models.Wallet{WalletID: walletID}, nil).Once()
+		mockRepo.On("GetTransactions", ctx, walletID, models.TransactionFilter{Limit: 51}).Return(transactions, nil).Once()
+
+		page, err := useCase.GetTransactions(ctx, walletID, models.TransactionFilter{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, transactions, page.Transactions)
+		assert.Empty(t, page.NextCursor)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("GetTransactions Next Cursor", func(t *testing.T) {
+		now := time.Now()
+		transactions := []models.Transaction{
+			{ID: uuid.New(), WalletID: walletID, CreatedAt: now},
+			{ID: uuid.New(), WalletID: walletID, CreatedAt: now.Add(-time.Second)},
+			{ID: uuid.New(), WalletID: walletID, CreatedAt: now.Add(-2 * time.Second)},
+		}
+		mockRepo.On("Display", ctx, walletID).Return(&models.Wallet{WalletID: walletID}, nil).Once()
+		mockRepo.On("GetTransactions", ctx, walletID, models.TransactionFilter{Limit: 3}).Return(transactions, nil).Once()
+
+		page, err := useCase.GetTransactions(ctx, walletID, models.TransactionFilter{Limit: 2})
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Transactions, 2)
+		cursor, err := models.ParseTransactionCursor(page.NextCursor)
+		assert.NoError(t, err)
+		assert.Equal(t, transactions[1].ID, cursor.ID)
+		assert.True(t, transactions[1].CreatedAt.Equal(cursor.CreatedAt))
 		mockRepo.AssertExpectations(t)
 	})
+
+	t.Run("GetTransactions Wallet Not Found", func(t *testing.T) {
+		mockRepo.On("Display", ctx, walletID).Return(nil, wallet.ErrWalletNotFound).Once()
+
+		_, err := useCase.GetTransactions(ctx, walletID, models.TransactionFilter{})
+
+		assert.ErrorIs(t, err, wallet.ErrWalletNotFound)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("ReserveIdempotencyKey New Key", func(t *testing.T) {
+		mockRepo.On("ReserveIdempotencyKey", ctx, "key", "hash").Return(nil, nil).Once()
+
+		record, err := useCase.ReserveIdempotencyKey(ctx, "key", "hash")
+
+		assert.NoError(t, err)
+		assert.Nil(t, record)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("ReserveIdempotencyKey Replay", func(t *testing.T) {
+		stored := &models.IdempotencyKey{Key: "key", RequestHash: "hash", StatusCode: 200, Response: []byte("{}")}
+		mockRepo.On("ReserveIdempotencyKey", ctx, "key", "hash").Return(stored, nil).Once()
+
+		record, err := useCase.ReserveIdempotencyKey(ctx, "key", "hash")
+
+		assert.NoError(t, err)
+		assert.Equal(t, stored, record)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("ReserveIdempotencyKey Different Payload", func(t *testing.T) {
+		stored := &models.IdempotencyKey{Key: "key", RequestHash: "other", StatusCode: 200}
+		mockRepo.On("ReserveIdempotencyKey", ctx, "key", "hash").Return(stored, nil).Once()
+
+		_, err := useCase.ReserveIdempotencyKey(ctx, "key", "hash")
+
+		assert.ErrorIs(t, err, wallet.ErrIdempotencyKeyReused)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("ReserveIdempotencyKey In Progress", func(t *testing.T) {
+		stored := &models.IdempotencyKey{Key: "key", RequestHash: "hash"}
+		mockRepo.On("ReserveIdempotencyKey", ctx, "key", "hash").Return(stored, nil).Once()
+
+		_, err := useCase.ReserveIdempotencyKey(ctx, "key", "hash")
+
+		assert.ErrorIs(t, err, wallet.ErrOperationInProgress)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Transfer Success", func(t *testing.T) {
+		toID := uuid.New()
+		transaction := &models.Transaction{ID: uuid.New(), WalletID: walletID, Type: models.TransactionTypeTransferOut, Amount: amount}
+		mockRepo.On("Transfer", ctx, walletID, toID, amount).Return(transaction, nil).Once()
+
+		result, err := useCase.Transfer(ctx, walletID, toID, amount)
+
+		assert.NoError(t, err)
+		assert.Equal(t, transaction, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Transfer Same Wallet", func(t *testing.T) {
+		_, err := useCase.Transfer(ctx, walletID, walletID, amount)
+
+		assert.ErrorIs(t, err, wallet.ErrSameWallet)
+	})
+
+	t.Run("UpdateStatus Success", func(t *testing.T) {
+		frozen := &models.Wallet{WalletID: walletID, Status: models.WalletStatusFrozen}
+		mockRepo.On("UpdateStatus", ctx, walletID, models.WalletStatusFrozen).Return(frozen, nil).Once()
+
+		result, err := useCase.UpdateStatus(ctx, walletID, models.WalletStatusFrozen)
+
+		assert.NoError(t, err)
+		assert.Equal(t, frozen, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("UpdateStatus Unknown Status", func(t *testing.T) {
+		_, err := useCase.UpdateStatus(ctx, walletID, "deleted")
+
+		assert.ErrorIs(t, err, wallet.ErrInvalidStatusTransition)
+	})
 }
@@ -3,6 +3,7 @@ package wallet
 import (
 	"context"
 
+	"github.com/22Fariz22/wallet/internal/models"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
 )
@@ -12,22 +13,147 @@ type MockWalletUsecase struct {
 	mock.Mock
 }
 
-func (m *MockWalletUsecase) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) error {
+func (m *MockWalletUsecase) Deposit(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
 	args := m.Called(ctx, walletID, amount)
-	return args.Error(0)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
 }
 
-func (m *MockWalletUsecase) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) error {
+func (m *MockWalletUsecase) Withdraw(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Transaction, error) {
 	args := m.Called(ctx, walletID, amount)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
+}
+
+func (m *MockWalletUsecase) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, fromID, toID, amount)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
+}
+
+func (m *MockWalletUsecase) Reverse(ctx context.Context, walletID, transactionID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, walletID, transactionID, amount)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
+}
+
+func (m *MockWalletUsecase) Hold(ctx context.Context, walletID uuid.UUID, amount int64) (*models.Hold, error) {
+	args := m.Called(ctx, walletID, amount)
+	hold, _ := args.Get(0).(*models.Hold)
+	return hold, args.Error(1)
+}
+
+func (m *MockWalletUsecase) Capture(ctx context.Context, walletID, holdID uuid.UUID, amount int64) (*models.Transaction, error) {
+	args := m.Called(ctx, walletID, holdID, amount)
+	transaction, _ := args.Get(0).(*models.Transaction)
+	return transaction, args.Error(1)
+}
+
+func (m *MockWalletUsecase) Release(ctx context.Context, walletID, holdID uuid.UUID) (*models.Hold, error) {
+	args := m.Called(ctx, walletID, holdID)
+	hold, _ := args.Get(0).(*models.Hold)
+	return hold, args.Error(1)
+}
+
+func (m *MockWalletUsecase) ExpireHolds(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockWalletUsecase) CreateSchedule(ctx context.Context, s *models.Schedule) (*models.Schedule, error) {
+	args := m.Called(ctx, s)
+	created, _ := args.Get(0).(*models.Schedule)
+	return created, args.Error(1)
+}
+
+func (m *MockWalletUsecase) ListSchedules(ctx context.Context, walletID uuid.UUID) ([]models.Schedule, error) {
+	args := m.Called(ctx, walletID)
+	schedules, _ := args.Get(0).([]models.Schedule)
+	return schedules, args.Error(1)
+}
+
+func (m *MockWalletUsecase) CancelSchedule(ctx context.Context, walletID, scheduleID uuid.UUID) (*models.Schedule, error) {
+	args := m.Called(ctx, walletID, scheduleID)
+	schedule, _ := args.Get(0).(*models.Schedule)
+	return schedule, args.Error(1)
+}
+
+func (m *MockWalletUsecase) GetScheduleExecutions(ctx context.Context, walletID, scheduleID uuid.UUID) ([]models.ScheduleExecution, error) {
+	args := m.Called(ctx, walletID, scheduleID)
+	executions, _ := args.Get(0).([]models.ScheduleExecution)
+	return executions, args.Error(1)
+}
+
+func (m *MockWalletUsecase) RunDueSchedules(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockWalletUsecase) Display(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
+	args := m.Called(ctx, walletID)
+	w, _ := args.Get(0).(*models.Wallet)
+	return w, args.Error(1)
+}
+
+func (m *MockWalletUsecase) CheckCurrency(ctx context.Context, walletID uuid.UUID, currency string) error {
+	args := m.Called(ctx, walletID, currency)
 	return args.Error(0)
 }
 
-func (m *MockWalletUsecase) Display(ctx context.Context, walletID uuid.UUID) (int64, error) {
+func (m *MockWalletUsecase) CreateWallet(ctx context.Context, params models.WalletParams) (*models.Wallet, error) {
+	args := m.Called(ctx, params)
+	w, _ := args.Get(0).(*models.Wallet)
+	return w, args.Error(1)
+}
+
+func (m *MockWalletUsecase) ListWallets(ctx context.Context, ownerID string) ([]models.Wallet, error) {
+	args := m.Called(ctx, ownerID)
+	wallets, _ := args.Get(0).([]models.Wallet)
+	return wallets, args.Error(1)
+}
+
+func (m *MockWalletUsecase) UpdateStatus(ctx context.Context, walletID uuid.UUID, status string) (*models.Wallet, error) {
+	args := m.Called(ctx, walletID, status)
+	w, _ := args.Get(0).(*models.Wallet)
+	return w, args.Error(1)
+}
+
+func (m *MockWalletUsecase) GetLimits(ctx context.Context, walletID uuid.UUID) (*models.WalletLimits, error) {
 	args := m.Called(ctx, walletID)
-	return args.Get(0).(int64), args.Error(1)
+	limits, _ := args.Get(0).(*models.WalletLimits)
+	return limits, args.Error(1)
 }
 
-func (m *MockWalletUsecase) CreateWallet(ctx context.Context) (uuid.UUID, error) {
+func (m *MockWalletUsecase) SetLimits(ctx context.Context, limits *models.WalletLimits) (*models.WalletLimits, error) {
+	args := m.Called(ctx, limits)
+	updated, _ := args.Get(0).(*models.WalletLimits)
+	return updated, args.Error(1)
+}
+
+func (m *MockWalletUsecase) GetTransactions(ctx context.Context, walletID uuid.UUID, filter models.TransactionFilter) (*models.TransactionPage, error) {
+	args := m.Called(ctx, walletID, filter)
+	page, _ := args.Get(0).(*models.TransactionPage)
+	return page, args.Error(1)
+}
+
+func (m *MockWalletUsecase) CheckLedger(ctx context.Context) (*models.LedgerCheck, error) {
 	args := m.Called(ctx)
-	return args.Get(0).(uuid.UUID), args.Error(1)
+	check, _ := args.Get(0).(*models.LedgerCheck)
+	return check, args.Error(1)
+}
+
+func (m *MockWalletUsecase) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*models.IdempotencyKey, error) {
+	args := m.Called(ctx, key, requestHash)
+	record, _ := args.Get(0).(*models.IdempotencyKey)
+	return record, args.Error(1)
+}
+
+func (m *MockWalletUsecase) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	args := m.Called(ctx, key, statusCode, response)
+	return args.Error(0)
+}
+
+func (m *MockWalletUsecase) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
 }
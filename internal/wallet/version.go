@@ -0,0 +1,17 @@
+package wallet
+
+import "context"
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion требует, чтобы операция над кошельком выполнилась только при
+// указанной версии. Иначе репозиторий вернет ErrVersionMismatch
+func WithExpectedVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+// ExpectedVersion версия кошелька, ожидаемая клиентом, если она задана
+func ExpectedVersion(ctx context.Context) (int64, bool) {
+	version, ok := ctx.Value(expectedVersionKey{}).(int64)
+	return version, ok
+}
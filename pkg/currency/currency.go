@@ -0,0 +1,65 @@
+package currency
+
+import (
+	"strconv"
+	"strings"
+)
+
+// minorUnits экспонента минимальной единицы для поддерживаемых кодов ISO 4217:
+// сумма в кошельке хранится целым числом минимальных единиц (центы, копейки и т.п.)
+var minorUnits = map[string]int{
+	"AED": 2,
+	"BHD": 3,
+	"CHF": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"KZT": 2,
+	"RUB": 2,
+	"TRY": 2,
+	"USD": 2,
+	"UZS": 2,
+}
+
+// Normalize приводит код валюты к каноническому виду (верхний регистр, без пробелов)
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// IsSupported проверяет, что код валюты известен сервису
+func IsSupported(code string) bool {
+	_, ok := minorUnits[code]
+	return ok
+}
+
+// MinorUnits возвращает экспоненту минимальной единицы валюты
+func MinorUnits(code string) (int, bool) {
+	exp, ok := minorUnits[code]
+	return exp, ok
+}
+
+// Format переводит сумму в минимальных единицах в десятичную строку, например 12345 RUB -> "123.45"
+func Format(amount int64, code string) string {
+	exp, ok := minorUnits[code]
+	if !ok || exp == 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+
+	sign := ""
+	abs := uint64(amount)
+	if amount < 0 {
+		sign = "-"
+		abs = uint64(-amount)
+	}
+
+	digits := strconv.FormatUint(abs, 10)
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+
+	point := len(digits) - exp
+	return sign + digits[:point] + "." + digits[point:]
+}
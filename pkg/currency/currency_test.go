@@ -0,0 +1,33 @@
+package currency
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount int64
+		code   string
+		want   string
+	}{
+		{12345, "RUB", "123.45"},
+		{5, "USD", "0.05"},
+		{0, "EUR", "0.00"},
+		{-150, "USD", "-1.50"},
+		{1500, "JPY", "1500"},
+		{1234, "KWD", "1.234"},
+		{math.MinInt64, "USD", "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Format(tt.amount, tt.code), "%d %s", tt.amount, tt.code)
+	}
+}
+
+func TestIsSupported(t *testing.T) {
+	assert.True(t, IsSupported(Normalize(" usd ")))
+	assert.False(t, IsSupported("XXX"))
+}
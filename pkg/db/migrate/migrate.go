@@ -1,21 +1,315 @@
 package migrate
 
 import (
-	"github.com/22Fariz22/wallet/internal/models"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
 	"github.com/22Fariz22/wallet/pkg/logger"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"github.com/jmoiron/sqlx"
 )
 
-// Migrate applies database migrations
-func Migrate(logger logger.Logger, dsn string) error {
-	// Инициализация GORM с использованием только для миграций
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// lockID ключ advisory-блокировки миграций: реплики, стартующие одновременно,
+// применяют миграции по очереди, а не наперегонки
+const lockID int64 = 0x77616c6c6574 // "wallet"
+
+// fileName имя файла миграции: 000001_create_wallets.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration одна версия схемы. Up и Down выполняются целиком в транзакции
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator применяет и откатывает встроенные в бинарник миграции.
+// Примененные версии хранятся в таблице schema_migrations
+type Migrator struct {
+	db         *sqlx.DB
+	logger     logger.Logger
+	migrations []Migration
+}
+
+// NewMigrator читает миграции, встроенные через embed
+func NewMigrator(db *sqlx.DB, logger logger.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, logger: logger, migrations: migrations}, nil
+}
+
+// Migrate применяет все еще не примененные миграции
+func Migrate(ctx context.Context, logger logger.Logger, db *sqlx.DB) error {
+	m, err := NewMigrator(db, logger)
 	if err != nil {
-		logger.Debugf("Error in pkg/db/migrate/migrate.go")
 		return err
 	}
+	_, err = m.Up(ctx)
+	return err
+}
+
+// Up применяет непримененные миграции по возрастанию версии и возвращает их число
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if versions[mig.Version] {
+				continue
+			}
+			m.logger.Infof("Applying migration %d_%s", mig.Version, mig.Name)
+			err := inTx(ctx, conn, mig.Up,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mig.Version, mig.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает steps последних примененных миграций и возвращает их число
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			mig := m.migrations[i]
+			if !versions[mig.Version] {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", mig.Version, mig.Name)
+			}
+			m.logger.Infof("Reverting migration %d_%s", mig.Version, mig.Name)
+			err := inTx(ctx, conn, mig.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus состояние одной версии схемы в базе
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	// AppliedAt nil, если миграция еще не применена
+	AppliedAt *time.Time
+	// Unknown миграция записана в базе, но ее нет в этом бинарнике: база новее кода
+	Unknown bool
+}
+
+// Status возвращает известные и примененные миграции по возрастанию версии
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		var applied []struct {
+			Version   int64     `db:"version"`
+			Name      string    `db:"name"`
+			AppliedAt time.Time `db:"applied_at"`
+		}
+		if err := conn.SelectContext(ctx, &applied, "SELECT version, name, applied_at FROM schema_migrations"); err != nil {
+			return err
+		}
+
+		byVersion := make(map[int64]*MigrationStatus, len(m.migrations)+len(applied))
+		for _, mig := range m.migrations {
+			byVersion[mig.Version] = &MigrationStatus{Version: mig.Version, Name: mig.Name}
+		}
+		for i := range applied {
+			st, ok := byVersion[applied[i].Version]
+			if !ok {
+				st = &MigrationStatus{Version: applied[i].Version, Name: applied[i].Name, Unknown: true}
+				byVersion[st.Version] = st
+			}
+			st.AppliedAt = &applied[i].AppliedAt
+		}
+
+		statuses = make([]MigrationStatus, 0, len(byVersion))
+		for _, st := range byVersion {
+			statuses = append(statuses, *st)
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+// Force записывает, что применены ровно миграции до version включительно, не выполняя скриптов.
+// Нужен после ручного исправления схемы; version 0 помечает все миграции непримененными
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	known := version == 0
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
 
-	// Выполнение миграций
-	return db.AutoMigrate(&models.Wallet{})
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		tx, err := conn.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version > $1", version); err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING",
+				mig.Version, mig.Name)
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		m.logger.Warnf("Migration version forced to %d", version)
+		return nil
+	})
+}
+
+// withLock выполняет fn на отдельном соединении под advisory-блокировкой.
+// Блокировка сессионная, поэтому все запросы идут через одно соединение
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Снимаем блокировку и при отмененном ctx, иначе она останется на соединении в пуле
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			m.logger.Errorf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    bigint PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions версии, записанные в schema_migrations
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) (map[int64]bool, error) {
+	var list []int64
+	if err := conn.SelectContext(ctx, &list, "SELECT version FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+	versions := make(map[int64]bool, len(list))
+	for _, v := range list {
+		versions[v] = true
+	}
+	return versions, nil
+}
+
+// inTx выполняет скрипт миграции и запись о версии в одной транзакции:
+// DDL в Postgres транзакционный, поэтому упавшая миграция не оставляет схему наполовину измененной
+func inTx(ctx context.Context, conn *sqlx.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Без аргументов запрос уходит простым протоколом, и скрипт может состоять из нескольких команд
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// loadMigrations собирает пары up/down из каталога dir и сортирует их по версии
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", e.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by %q and %q", version, mig.Name, match[2])
+		}
+		if match[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
 }
@@ -0,0 +1,259 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "github.com/jackc/pgx/stdlib" // pgx driver
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	// Версии идут подряд с единицы, и каждую миграцию можно откатить
+	for i, mig := range migrations {
+		assert.Equal(t, int64(i+1), mig.Version)
+		assert.NotEmpty(t, mig.Down, "migration %d_%s has no down script", mig.Version, mig.Name)
+	}
+}
+
+func TestWalletsUpgradeColumns(t *testing.T) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	require.NoError(t, err)
+	up := migrations[0].Up
+
+	// Каждая колонка из CREATE TABLE, кроме двух колонок схемы GORM, должна
+	// добавляться и в уже существующую таблицу
+	create := regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS wallets \((.*?)\n\);`).FindStringSubmatch(up)
+	require.NotNil(t, create)
+	for _, line := range strings.Split(create[1], "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "wallet_id" || fields[0] == "amount" {
+			continue
+		}
+		assert.Regexp(t, `ADD COLUMN IF NOT EXISTS `+fields[0]+`\s`, up)
+	}
+}
+
+// TestUpgradeFromGormSchema прогоняет все миграции на базе, созданной GORM AutoMigrate
+// до перехода на SQL-миграции. Нужен Postgres: MIGRATE_TEST_DSN=postgres://...
+func TestUpgradeFromGormSchema(t *testing.T) {
+	dsn := os.Getenv("MIGRATE_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MIGRATE_TEST_DSN is not set")
+	}
+	ctx := context.Background()
+
+	db, err := sqlx.Connect("pgx", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// Отдельная схема на одном соединении: search_path сессионный
+	db.SetMaxOpenConns(1)
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	_, err = db.ExecContext(ctx, "CREATE SCHEMA "+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+	_, err = db.ExecContext(ctx, "SET search_path TO "+schema)
+	require.NoError(t, err)
+
+	// Таблица в том виде, в каком ее создавал GORM
+	_, err = db.ExecContext(ctx, "CREATE TABLE wallets (wallet_id uuid PRIMARY KEY, amount bigint NOT NULL)")
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "INSERT INTO wallets (wallet_id, amount) VALUES ('7f7c6f3e-4b1a-4c55-9a55-2f4e1b0c8a11', 100)")
+	require.NoError(t, err)
+
+	m, err := NewMigrator(db, logger.NewMockLogger())
+	require.NoError(t, err)
+	applied, err := m.Up(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, len(m.migrations), applied)
+
+	var w struct {
+		Amount   int64  `db:"amount"`
+		Currency string `db:"currency"`
+		Held     int64  `db:"held"`
+		Status   string `db:"status"`
+	}
+	err = db.GetContext(ctx, &w, "SELECT amount, currency, held, status FROM wallets")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), w.Amount)
+	assert.Equal(t, "RUB", w.Currency)
+	assert.Equal(t, "active", w.Status)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("Sorted By Version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"m/000002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+			"m/000001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+			"m/000001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+			"m/000002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		}
+
+		migrations, err := loadMigrations(fsys, "m")
+
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+		assert.Equal(t, Migration{Version: 1, Name: "first", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"}, migrations[0])
+		assert.Equal(t, "second", migrations[1].Name)
+	})
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"Bad File Name", fstest.MapFS{"m/create_wallets.sql": {}}},
+		{"Missing Up", fstest.MapFS{"m/000001_first.down.sql": {Data: []byte("DROP TABLE a;")}}},
+		{"Duplicate Version", fstest.MapFS{
+			"m/000001_first.up.sql":  {Data: []byte("CREATE TABLE a ();")},
+			"m/000001_second.up.sql": {Data: []byte("CREATE TABLE b ();")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	migrations := []Migration{
+		{Version: 1, Name: "first", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "second", Up: "CREATE TABLE b ();", Down: "DROP TABLE b;"},
+	}
+
+	newMigrator := func(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		return &Migrator{db: sqlx.NewDb(db, "sqlmock"), logger: logger.NewMockLogger(), migrations: migrations}, mock
+	}
+
+	expectLock := func(mock sqlmock.Sqlmock, applied ...int64) {
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+		rows := sqlmock.NewRows([]string{"version"})
+		for _, v := range applied {
+			rows.AddRow(v)
+		}
+		mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(rows)
+	}
+
+	expectUnlock := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	t.Run("Up Applies Pending", func(t *testing.T) {
+		m, mock := newMigrator(t)
+		expectLock(mock, 1)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE b ();")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(int64(2), "second").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectUnlock(mock)
+
+		applied, err := m.Up(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Up Failed Migration", func(t *testing.T) {
+		m, mock := newMigrator(t)
+		expectLock(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE a ();")).WillReturnError(errors.New("syntax error"))
+		mock.ExpectRollback()
+		expectUnlock(mock)
+
+		applied, err := m.Up(ctx)
+
+		// Следующие миграции не применяются поверх упавшей
+		assert.ErrorContains(t, err, "migration 1_first")
+		assert.Equal(t, 0, applied)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Down Reverts Latest", func(t *testing.T) {
+		m, mock := newMigrator(t)
+		expectLock(mock, 1, 2)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DROP TABLE b;")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectUnlock(mock)
+
+		reverted, err := m.Down(ctx, 1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, reverted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		m, mock := newMigrator(t)
+		appliedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT version, name, applied_at FROM schema_migrations").WillReturnRows(
+			sqlmock.NewRows([]string{"version", "name", "applied_at"}).
+				AddRow(int64(1), "first", appliedAt).
+				AddRow(int64(3), "from_newer_release", appliedAt))
+		expectUnlock(mock)
+
+		statuses, err := m.Status(ctx)
+
+		require.NoError(t, err)
+		assert.Equal(t, []MigrationStatus{
+			{Version: 1, Name: "first", AppliedAt: &appliedAt},
+			{Version: 2, Name: "second"},
+			{Version: 3, Name: "from_newer_release", AppliedAt: &appliedAt, Unknown: true},
+		}, statuses)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		m, mock := newMigrator(t)
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM schema_migrations WHERE version > ").WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO schema_migrations .* ON CONFLICT").WithArgs(int64(1), "first").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		expectUnlock(mock)
+
+		err := m.Force(ctx, 1)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Force Unknown Version", func(t *testing.T) {
+		m, mock := newMigrator(t)
+
+		err := m.Force(ctx, 7)
+
+		assert.ErrorContains(t, err, "unknown migration version 7")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
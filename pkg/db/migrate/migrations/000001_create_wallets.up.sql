@@ -0,0 +1,25 @@
+-- IF NOT EXISTS: базы, созданные до перехода на SQL-миграции, уже содержат эти таблицы
+CREATE TABLE IF NOT EXISTS wallets (
+    wallet_id uuid PRIMARY KEY,
+    amount    bigint NOT NULL,
+    currency  char(3) NOT NULL DEFAULT 'RUB',
+    held      bigint NOT NULL DEFAULT 0,
+    version   bigint NOT NULL DEFAULT 0,
+    status    varchar(16) NOT NULL DEFAULT 'active',
+    owner_id  varchar(255) NOT NULL DEFAULT '',
+    label     varchar(255) NOT NULL DEFAULT '',
+    metadata  jsonb NOT NULL DEFAULT '{}'
+);
+
+-- В такой базе таблицу создал GORM AutoMigrate только с wallet_id и amount:
+-- CREATE TABLE ее не меняет, поэтому остальные колонки добавляются отдельно
+ALTER TABLE wallets
+    ADD COLUMN IF NOT EXISTS currency char(3) NOT NULL DEFAULT 'RUB',
+    ADD COLUMN IF NOT EXISTS held     bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS version  bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS status   varchar(16) NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS owner_id varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS label    varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS metadata jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_wallets_owner_id ON wallets (owner_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS wallet_transactions (
+    id              uuid PRIMARY KEY,
+    wallet_id       uuid NOT NULL,
+    type            varchar(32) NOT NULL,
+    amount          bigint NOT NULL,
+    balance_after   bigint NOT NULL,
+    counterparty_id uuid,
+    reversal_of     uuid,
+    created_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_history ON wallet_transactions (wallet_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_reversal_of ON wallet_transactions (reversal_of);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key          varchar(255) PRIMARY KEY,
+    request_hash varchar(64) NOT NULL,
+    status_code  bigint NOT NULL DEFAULT 0,
+    response     bytea,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
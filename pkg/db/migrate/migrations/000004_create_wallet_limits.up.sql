@@ -0,0 +1,8 @@
+-- NULL означает лимит по умолчанию из настроек, 0 отключает ограничение
+CREATE TABLE IF NOT EXISTS wallet_limits (
+    wallet_id                uuid PRIMARY KEY,
+    max_operation_amount     bigint,
+    max_balance              bigint,
+    daily_withdrawal_limit   bigint,
+    monthly_withdrawal_limit bigint
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS wallet_holds (
+    id         uuid PRIMARY KEY,
+    wallet_id  uuid NOT NULL,
+    amount     bigint NOT NULL,
+    captured   bigint NOT NULL DEFAULT 0,
+    status     varchar(16) NOT NULL DEFAULT 'active',
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_holds_wallet_id ON wallet_holds (wallet_id);
+-- Поиск просроченных активных холдов воркером
+CREATE INDEX IF NOT EXISTS idx_wallet_holds_expiry ON wallet_holds (status, expires_at);
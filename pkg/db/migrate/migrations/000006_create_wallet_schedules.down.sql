@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS wallet_schedule_executions;
+DROP TABLE IF EXISTS wallet_schedules;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS wallet_schedules (
+    id             uuid PRIMARY KEY,
+    wallet_id      uuid NOT NULL,
+    operation_type varchar(16) NOT NULL,
+    to_wallet_id   uuid,
+    amount         bigint NOT NULL,
+    recurrence     varchar(16) NOT NULL DEFAULT '',
+    start_at       timestamptz NOT NULL,
+    next_run_at    timestamptz NOT NULL,
+    iteration      bigint NOT NULL DEFAULT 0,
+    status         varchar(16) NOT NULL DEFAULT 'active',
+    created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_schedules_wallet_id ON wallet_schedules (wallet_id);
+-- Выборка расписаний, которым пора запускаться
+CREATE INDEX IF NOT EXISTS idx_wallet_schedules_due ON wallet_schedules (status, next_run_at);
+
+CREATE TABLE IF NOT EXISTS wallet_schedule_executions (
+    id             uuid PRIMARY KEY,
+    schedule_id    uuid NOT NULL,
+    run_at         timestamptz NOT NULL,
+    status         varchar(16) NOT NULL,
+    transaction_id uuid,
+    error          text NOT NULL DEFAULT '',
+    started_at     timestamptz NOT NULL DEFAULT now(),
+    finished_at    timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_schedule_executions_history ON wallet_schedule_executions (schedule_id, run_at);
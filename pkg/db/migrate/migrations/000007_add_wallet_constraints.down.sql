@@ -0,0 +1,19 @@
+ALTER TABLE wallet_limits DROP CONSTRAINT IF EXISTS wallet_limits_non_negative;
+
+ALTER TABLE wallet_schedules DROP CONSTRAINT IF EXISTS wallet_schedules_amount_positive;
+
+ALTER TABLE wallet_holds
+    DROP CONSTRAINT IF EXISTS wallet_holds_amounts_non_negative,
+    DROP CONSTRAINT IF EXISTS wallet_holds_status_valid;
+
+ALTER TABLE wallet_transactions
+    DROP CONSTRAINT IF EXISTS wallet_transactions_amount_positive,
+    DROP CONSTRAINT IF EXISTS wallet_transactions_balance_after_non_negative;
+
+ALTER TABLE wallets
+    DROP CONSTRAINT IF EXISTS wallets_amount_non_negative,
+    DROP CONSTRAINT IF EXISTS wallets_held_within_amount,
+    DROP CONSTRAINT IF EXISTS wallets_version_non_negative,
+    DROP CONSTRAINT IF EXISTS wallets_status_valid,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,33 @@
+-- updated_at выставляет репозиторий при каждом изменении кошелька
+ALTER TABLE wallets
+    ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+
+-- Инварианты баланса проверяются и для записей в обход сервиса.
+-- Held входит в amount, поэтому доступный остаток amount - held тоже неотрицателен.
+-- NOT VALID: ограничения действуют для новых и измененных строк, а существующие не проверяются.
+-- Старые версии допускали отрицательные балансы и суммы, и миграция не должна падать на таких данных.
+-- Существующие строки проверяет 000009_validate_wallet_constraints
+ALTER TABLE wallets
+    ADD CONSTRAINT wallets_amount_non_negative CHECK (amount >= 0) NOT VALID,
+    ADD CONSTRAINT wallets_held_within_amount CHECK (held >= 0 AND held <= amount) NOT VALID,
+    ADD CONSTRAINT wallets_version_non_negative CHECK (version >= 0) NOT VALID,
+    ADD CONSTRAINT wallets_status_valid CHECK (status IN ('active', 'frozen', 'closed')) NOT VALID;
+
+ALTER TABLE wallet_transactions
+    ADD CONSTRAINT wallet_transactions_amount_positive CHECK (amount > 0) NOT VALID,
+    ADD CONSTRAINT wallet_transactions_balance_after_non_negative CHECK (balance_after >= 0) NOT VALID;
+
+ALTER TABLE wallet_holds
+    ADD CONSTRAINT wallet_holds_amounts_non_negative CHECK (amount >= 0 AND captured >= 0) NOT VALID,
+    ADD CONSTRAINT wallet_holds_status_valid CHECK (status IN ('active', 'captured', 'released', 'expired')) NOT VALID;
+
+ALTER TABLE wallet_schedules
+    ADD CONSTRAINT wallet_schedules_amount_positive CHECK (amount > 0) NOT VALID;
+
+-- NULL означает лимит по умолчанию и проходит проверку
+ALTER TABLE wallet_limits
+    ADD CONSTRAINT wallet_limits_non_negative CHECK (
+        max_operation_amount >= 0 AND max_balance >= 0
+        AND daily_withdrawal_limit >= 0 AND monthly_withdrawal_limit >= 0
+    ) NOT VALID;
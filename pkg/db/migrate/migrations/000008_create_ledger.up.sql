@@ -0,0 +1,36 @@
+-- Главная книга двойной записи. Каждая проводка состоит из ног, сумма которых равна нулю
+CREATE TABLE ledger_entries (
+    id             uuid PRIMARY KEY,
+    type           varchar(32) NOT NULL,
+    -- transaction_id запись журнала кошелька, породившая проводку
+    transaction_id uuid,
+    created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_ledger_entries_transaction_id ON ledger_entries (transaction_id);
+
+-- Счет ноги либо кошелек, либо системный счет (funding, payout, opening)
+CREATE TABLE ledger_postings (
+    entry_id       uuid NOT NULL REFERENCES ledger_entries (id),
+    leg            smallint NOT NULL,
+    wallet_id      uuid REFERENCES wallets (wallet_id),
+    system_account varchar(64),
+    amount         bigint NOT NULL,
+    PRIMARY KEY (entry_id, leg),
+    CONSTRAINT ledger_postings_single_account CHECK ((wallet_id IS NULL) <> (system_account IS NULL)),
+    CONSTRAINT ledger_postings_amount_non_zero CHECK (amount <> 0)
+);
+
+CREATE INDEX idx_ledger_postings_wallet_id ON ledger_postings (wallet_id);
+CREATE INDEX idx_ledger_postings_system_account ON ledger_postings (system_account);
+
+-- Балансы, накопленные до появления книги, проводятся со счета opening.
+-- ID проводки совпадает с ID кошелька: такая проводка у кошелька одна
+INSERT INTO ledger_entries (id, type)
+SELECT wallet_id, 'OPENING' FROM wallets WHERE amount <> 0;
+
+INSERT INTO ledger_postings (entry_id, leg, system_account, amount)
+SELECT wallet_id, 1, 'opening', -amount FROM wallets WHERE amount <> 0;
+
+INSERT INTO ledger_postings (entry_id, leg, wallet_id, amount)
+SELECT wallet_id, 2, wallet_id, amount FROM wallets WHERE amount <> 0;
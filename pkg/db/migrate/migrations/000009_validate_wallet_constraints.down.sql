@@ -0,0 +1,3 @@
+-- Проверенное ограничение нельзя снова сделать NOT VALID, да и незачем:
+-- строки уже ему соответствуют. Ограничения удаляет откат 000007
+SELECT 1;
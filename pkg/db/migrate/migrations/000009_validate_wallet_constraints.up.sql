@@ -0,0 +1,35 @@
+-- Проверяет существующие строки на ограничения из 000007. Кошельки, нарушающие их,
+-- перечисляются в ошибке: исправлять балансы автоматически нельзя, это решение оператора
+DO $$
+DECLARE
+    broken text;
+BEGIN
+    SELECT string_agg(format('%s (amount %s, held %s, status %s)', wallet_id, amount, held, status), ', ')
+    INTO broken
+    FROM (
+        SELECT wallet_id, amount, held, status FROM wallets
+        WHERE amount < 0 OR held < 0 OR held > amount OR version < 0
+            OR status NOT IN ('active', 'frozen', 'closed')
+        ORDER BY wallet_id
+        LIMIT 20
+    ) w;
+
+    IF broken IS NOT NULL THEN
+        RAISE EXCEPTION 'wallets violate balance constraints, fix them as described in README "Constraint validation" and restart (first 20): %', broken;
+    END IF;
+END
+$$;
+
+ALTER TABLE wallets VALIDATE CONSTRAINT wallets_amount_non_negative;
+ALTER TABLE wallets VALIDATE CONSTRAINT wallets_held_within_amount;
+ALTER TABLE wallets VALIDATE CONSTRAINT wallets_version_non_negative;
+ALTER TABLE wallets VALIDATE CONSTRAINT wallets_status_valid;
+
+-- Остальные таблицы старые версии не заполняли в обход проверок сервиса
+ALTER TABLE wallet_holds VALIDATE CONSTRAINT wallet_holds_amounts_non_negative;
+ALTER TABLE wallet_holds VALIDATE CONSTRAINT wallet_holds_status_valid;
+ALTER TABLE wallet_schedules VALIDATE CONSTRAINT wallet_schedules_amount_positive;
+ALTER TABLE wallet_limits VALIDATE CONSTRAINT wallet_limits_non_negative;
+
+-- Ограничения wallet_transactions остаются NOT VALID: журнал это история, и записи
+-- старых версий с отрицательными суммами не переписываются. Новые записи проверяются
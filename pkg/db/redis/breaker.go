@@ -0,0 +1,241 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen команда не отправлялась: Redis считается недоступным
+var ErrCircuitOpen = errors.New("redis circuit breaker is open")
+
+// State состояние circuit breaker
+type State int
+
+const (
+	// StateClosed Redis доступен, команды идут как обычно
+	StateClosed State = iota
+	// StateOpen Redis недоступен, команды сразу завершаются с ErrCircuitOpen
+	StateOpen
+	// StateHalfOpen Redis проверяется пробой PING и обработчиками восстановления,
+	// команды клиентов по-прежнему завершаются с ErrCircuitOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker хук go-redis, который после серии сетевых ошибок перестает ходить в Redis,
+// чтобы запросы не ждали таймаут на каждой команде. Через openTimeout в фоне проверяет
+// Redis командой PING и выполняет обработчики восстановления; команды клиентов пойдут
+// в Redis, только когда и проба, и обработчики завершились успешно
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	onRecover []func(ctx context.Context) error
+	// ping проба доступности Redis, задается в Watch
+	ping func(ctx context.Context) error
+
+	threshold   int
+	openTimeout time.Duration
+	logger      logger.Logger
+	now         func() time.Time
+}
+
+// NewCircuitBreaker размыкается после threshold ошибок подряд и пробует Redis снова через openTimeout
+func NewCircuitBreaker(threshold int, openTimeout time.Duration, logger logger.Logger) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold:   max(threshold, 1),
+		openTimeout: openTimeout,
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// State текущее состояние для логов и health-проверки
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Watch подключает breaker к клиенту: хук на команды и PING клиента в качестве пробы
+func (b *CircuitBreaker) Watch(client *redis.Client) {
+	b.ping = func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+	client.AddHook(b)
+}
+
+// OnRecover регистрирует fn, которая выполняется после успешной пробы, пока breaker еще
+// полуоткрыт: команды клиентов в Redis не идут, а команды с ctx из fn проходят.
+// Ошибка fn считается неудачной пробой, и breaker снова размыкается
+func (b *CircuitBreaker) OnRecover(fn func(ctx context.Context) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onRecover = append(b.onRecover, fn)
+}
+
+// probeKey помечает ctx пробы и обработчиков восстановления: их команды проходят мимо breaker
+type probeKey struct{}
+
+func (b *CircuitBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (b *CircuitBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if isProbe(ctx) {
+			return next(ctx, cmd)
+		}
+		if err := b.allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+
+		err := next(ctx, cmd)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *CircuitBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if isProbe(ctx) {
+			return next(ctx, cmds)
+		}
+		if err := b.allow(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+
+		err := next(ctx, cmds)
+		b.record(err)
+		return err
+	}
+}
+
+// allow решает, можно ли отправить команду в Redis
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		// Пора проверить Redis. Сама команда туда не идет: снимки в кэше могли устареть,
+		// пока Redis был недоступен, и верить им можно только после восстановления
+		b.setState(StateHalfOpen)
+		go b.probe()
+		return ErrCircuitOpen
+	case StateHalfOpen:
+		// Проба или восстановление еще идут
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// probe проверяет Redis командой PING и выполняет обработчики восстановления.
+// Breaker замыкается, только если все они завершились успешно
+func (b *CircuitBreaker) probe() {
+	ctx := context.WithValue(context.Background(), probeKey{}, true)
+
+	if err := b.ping(ctx); err != nil {
+		b.reopen(err)
+		return
+	}
+
+	b.mu.Lock()
+	fns := append([]func(ctx context.Context) error(nil), b.onRecover...)
+	b.mu.Unlock()
+	for _, fn := range fns {
+		if err := fn(ctx); err != nil {
+			b.reopen(fmt.Errorf("recovery failed: %w", err))
+			return
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.setState(StateClosed)
+}
+
+// reopen неудачная проба: Redis снова считается недоступным на openTimeout
+func (b *CircuitBreaker) reopen(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trip(err)
+}
+
+// record учитывает результат команды. Команды, завершившиеся после размыкания,
+// на состояние уже не влияют: его меняет только проба
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateClosed {
+		return
+	}
+	if !isFailure(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.trip(err)
+	}
+}
+
+func (b *CircuitBreaker) trip(err error) {
+	b.openedAt = b.now()
+	b.setState(StateOpen)
+	b.logger.Warnf("Redis is unavailable, serving from Postgres for %s: %v", b.openTimeout, err)
+}
+
+func (b *CircuitBreaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	b.logger.Infof("Redis circuit breaker: %s -> %s", b.state, state)
+	b.state = state
+}
+
+// isProbe команда отправлена пробой или обработчиком восстановления
+func isProbe(ctx context.Context) bool {
+	probe, _ := ctx.Value(probeKey{}).(bool)
+	return probe
+}
+
+// isFailure ошибки, говорящие о недоступности Redis. Ответы самого Redis
+// (в том числе redis.Nil и NOSCRIPT) и отмена запроса клиентом сбоем не считаются
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
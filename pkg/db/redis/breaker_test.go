@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/22Fariz22/wallet/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock управляемое время для проверки таймаута размыкания
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestBreaker(threshold int) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	b := NewCircuitBreaker(threshold, 10*time.Second, logger.NewMockLogger())
+	b.now = clock.Now
+	return b, clock
+}
+
+// process прогоняет команду через хук, next возвращает nextErr
+func process(b *CircuitBreaker, nextErr error) (bool, error) {
+	called := false
+	hook := b.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		called = true
+		return nextErr
+	})
+	err := hook(context.Background(), redis.NewStringCmd(context.Background(), "get", "key"))
+	return called, err
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	networkErr := errors.New("dial tcp: connection refused")
+
+	t.Run("Trips After Threshold", func(t *testing.T) {
+		b, _ := newTestBreaker(3)
+
+		for i := 0; i < 2; i++ {
+			process(b, networkErr)
+		}
+		assert.Equal(t, StateClosed, b.State())
+
+		process(b, networkErr)
+		assert.Equal(t, StateOpen, b.State())
+
+		// В разомкнутом состоянии Redis не вызывается вовсе
+		called, err := process(b, nil)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.False(t, called)
+	})
+
+	t.Run("Success Resets Failures", func(t *testing.T) {
+		b, _ := newTestBreaker(2)
+
+		process(b, networkErr)
+		process(b, nil)
+		process(b, networkErr)
+
+		assert.Equal(t, StateClosed, b.State())
+	})
+
+	t.Run("Redis Replies Are Not Failures", func(t *testing.T) {
+		b, _ := newTestBreaker(1)
+
+		process(b, redis.Nil)
+		process(b, context.Canceled)
+
+		assert.Equal(t, StateClosed, b.State())
+	})
+
+	t.Run("Probe Closes Breaker", func(t *testing.T) {
+		b, clock := newTestBreaker(1)
+		pinged := make(chan struct{})
+		b.ping = func(ctx context.Context) error {
+			close(pinged)
+			return nil
+		}
+
+		process(b, networkErr)
+		assert.Equal(t, StateOpen, b.State())
+
+		clock.now = clock.now.Add(11 * time.Second)
+		called, err := process(b, nil)
+
+		// Команда, запустившая пробу, в Redis не идет: ее снимок мог устареть
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.False(t, called)
+		<-pinged
+		assert.Eventually(t, func() bool { return b.State() == StateClosed }, time.Second, time.Millisecond)
+
+		called, err = process(b, nil)
+		assert.NoError(t, err)
+		assert.True(t, called)
+	})
+
+	t.Run("Failed Probe Reopens Breaker", func(t *testing.T) {
+		b, clock := newTestBreaker(1)
+		b.ping = func(ctx context.Context) error { return networkErr }
+
+		process(b, networkErr)
+		openedAt := clock.now
+		clock.now = clock.now.Add(11 * time.Second)
+		process(b, nil)
+
+		assert.Eventually(t, func() bool {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			return b.state == StateOpen && b.openedAt.After(openedAt)
+		}, time.Second, time.Millisecond)
+		called, err := process(b, nil)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.False(t, called)
+	})
+
+	t.Run("Commands Miss Until Recovery Finishes", func(t *testing.T) {
+		b, clock := newTestBreaker(1)
+		b.ping = func(ctx context.Context) error { return nil }
+		flushing, flushed := make(chan struct{}), make(chan struct{})
+		b.OnRecover(func(ctx context.Context) error {
+			close(flushing)
+			// Команды очистки идут в Redis, хотя breaker еще полуоткрыт
+			hook := b.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error { return nil })
+			if err := hook(ctx, redis.NewIntCmd(ctx, "unlink", "key")); err != nil {
+				return err
+			}
+			<-flushed
+			return nil
+		})
+
+		process(b, networkErr)
+		clock.now = clock.now.Add(11 * time.Second)
+		process(b, nil)
+		<-flushing
+
+		called, err := process(b, nil)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.False(t, called)
+		assert.Equal(t, StateHalfOpen, b.State())
+
+		close(flushed)
+		assert.Eventually(t, func() bool { return b.State() == StateClosed }, time.Second, time.Millisecond)
+	})
+
+	t.Run("Failed Recovery Reopens Breaker", func(t *testing.T) {
+		b, clock := newTestBreaker(1)
+		b.ping = func(ctx context.Context) error { return nil }
+		recovered := make(chan struct{})
+		b.OnRecover(func(ctx context.Context) error {
+			defer close(recovered)
+			return networkErr
+		})
+
+		process(b, networkErr)
+		clock.now = clock.now.Add(11 * time.Second)
+		process(b, nil)
+		<-recovered
+
+		assert.Eventually(t, func() bool { return b.State() == StateOpen }, time.Second, time.Millisecond)
+	})
+
+	t.Run("Single Probe In Half-Open", func(t *testing.T) {
+		b, clock := newTestBreaker(1)
+		release := make(chan struct{})
+		defer close(release)
+		b.ping = func(ctx context.Context) error {
+			<-release
+			return nil
+		}
+
+		process(b, networkErr)
+		clock.now = clock.now.Add(11 * time.Second)
+
+		// Проба еще не завершилась: все команды отклоняются
+		assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+		assert.Equal(t, StateHalfOpen, b.State())
+		assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+	})
+}
@@ -4,11 +4,12 @@ import (
 	"time"
 
 	"github.com/22Fariz22/wallet/config"
+	"github.com/22Fariz22/wallet/pkg/logger"
 	"github.com/redis/go-redis/v9"
 )
 
-// Returns new redis client
-func NewRedisClient(cfg *config.Config) *redis.Client {
+// Returns new redis client guarded by a circuit breaker
+func NewRedisClient(cfg *config.Config, logger logger.Logger) (*redis.Client, *CircuitBreaker) {
 	client := redis.NewClient(&redis.Options{
 		Addr:         cfg.Redis.Addr,
 		MinIdleConns: cfg.Redis.MinIdleConns,
@@ -18,5 +19,8 @@ func NewRedisClient(cfg *config.Config) *redis.Client {
 		DB:           cfg.Redis.DB,
 	})
 
-	return client
+	breaker := NewCircuitBreaker(cfg.Redis.BreakerFailureThreshold, cfg.Redis.BreakerOpenTimeout, logger)
+	breaker.Watch(client)
+
+	return client, breaker
 }